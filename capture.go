@@ -0,0 +1,310 @@
+package ps
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scmn-dev/ps/internal/cgroups"
+	"github.com/scmn-dev/ps/internal/host"
+	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// Archive is a capture of the processes of a host written by Capture.  Pass
+// it via ProcessInfoOpts to list the captured processes instead of the live
+// ones.
+type Archive struct {
+	fs *procfs.Archive
+}
+
+// OpenArchive reads the capture at path.
+func OpenArchive(path string) (*Archive, error) {
+	a, err := procfs.OpenArchive(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening archive %s", path)
+	}
+
+	return &Archive{fs: a}, nil
+}
+
+// Time returns the time of the capture, which is the reference for the
+// elapsed time of the captured processes.
+func (a *Archive) Time() time.Time {
+	return a.fs.Time
+}
+
+var (
+	// captureHostFiles are the host-wide files captured.
+	captureHostFiles = []string{
+		"/proc/stat",
+		"/proc/loadavg",
+		"/proc/uptime",
+		"/proc/meminfo",
+		"/proc/sys/fs/overflowuid",
+		"/proc/sys/fs/overflowgid",
+		"/etc/passwd",
+		"/etc/group",
+	}
+
+	// captureProcessFiles are the files captured of each process below
+	// /proc/$pid.
+	captureProcessFiles = []string{
+		"stat",
+		"status",
+		"cmdline",
+		"attr/current",
+		"wchan",
+		"io",
+		"limits",
+		"net/tcp",
+		"net/tcp6",
+		"net/udp",
+		"net/udp6",
+		"net/unix",
+		"cgroup",
+		"uid_map",
+		"gid_map",
+	}
+
+	// captureTaskFiles are the files captured of each task below
+	// /proc/$pid/task/$tid.
+	captureTaskFiles = []string{
+		"stat",
+		"status",
+		"cmdline",
+		"attr/current",
+		"wchan",
+		"io",
+		"cgroup",
+	}
+)
+
+// Capture writes the files the descriptors are extracted from for the
+// processes with the specified pids, or all processes if pids is empty, to
+// w as a gzip-compressed tar archive.  Besides the files in /proc, the
+// archive contains the terminals in /dev as well as /etc/passwd and
+// /etc/group to resolve user and group names.  The roots of options select
+// the file system to capture.
+func Capture(w io.Writer, pids []string, options *ProcessInfoOpts) error {
+	fsys := options.fs()
+
+	clockTicks, err := host.ClockTicksOf(fsys)
+	if err != nil {
+		return err
+	}
+
+	a, err := procfs.NewArchiveWriter(w, fsys, time.Now(), clockTicks)
+	if err != nil {
+		return errors.Wrap(err, "error creating archive")
+	}
+
+	for _, name := range captureHostFiles {
+		if err := a.AddFile(name); err != nil {
+			return errors.Wrapf(err, "error capturing %s", name)
+		}
+	}
+
+	if err := captureTTYs(a, fsys); err != nil {
+		return err
+	}
+
+	if len(pids) == 0 {
+		pids, err = proc.GetPIDs(fsys)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := a.AddDir("/proc"); err != nil {
+		return err
+	}
+
+	for _, pid := range pids {
+		if err := captureProcess(a, fsys, pid); err != nil {
+			return errors.Wrapf(err, "error capturing PID %s", pid)
+		}
+	}
+
+	if err := captureCgroups(a, fsys, pids); err != nil {
+		return err
+	}
+
+	return a.Close()
+}
+
+// captureTTYs captures the device numbers of the terminals in /dev.
+func captureTTYs(a *procfs.ArchiveWriter, fsys procfs.FS) error {
+	for _, dir := range []string{"/dev", "/dev/pts"} {
+		if err := a.AddDir(dir); err != nil {
+			return err
+		}
+
+		names, err := fsys.ReadDirNames(dir)
+		if err != nil {
+			return errors.Wrapf(err, "error capturing %s", dir)
+		}
+
+		for _, name := range names {
+			if dir == "/dev" && !strings.HasPrefix(name, "tty") {
+				continue
+			}
+
+			if err := a.AddDevice(dir + "/" + name); err != nil {
+				return errors.Wrapf(err, "error capturing %s/%s", dir, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// captureProcess captures the files of process pid and its tasks.  Processes
+// exiting during the capture are skipped.
+func captureProcess(a *procfs.ArchiveWriter, fsys procfs.FS, pid string) error {
+	dir := "/proc/" + pid
+	for _, name := range captureProcessFiles {
+		if err := a.AddFile(dir + "/" + name); err != nil {
+			return err
+		}
+	}
+
+	if err := captureNamespaces(a, fsys, dir); err != nil {
+		return err
+	}
+
+	if err := captureFDs(a, dir); err != nil {
+		return err
+	}
+
+	if err := captureSmaps(a, fsys, dir); err != nil {
+		return err
+	}
+
+	tids, err := proc.GetTIDs(fsys, pid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if err := a.AddDir(dir + "/task"); err != nil {
+		return err
+	}
+
+	for _, tid := range tids {
+		taskDir := dir + "/task/" + tid
+		for _, name := range captureTaskFiles {
+			if err := a.AddFile(taskDir + "/" + name); err != nil {
+				return err
+			}
+		}
+
+		if err := captureNamespaces(a, fsys, taskDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// captureFDs captures the file descriptors in dir/fd along with their
+// dir/fdinfo.
+func captureFDs(a *procfs.ArchiveWriter, dir string) error {
+	fds, err := a.AddDirEntries(dir + "/fd")
+	if err != nil {
+		return err
+	}
+
+	if len(fds) == 0 {
+		return nil
+	}
+
+	if err := a.AddDir(dir + "/fdinfo"); err != nil {
+		return err
+	}
+
+	for _, fd := range fds {
+		if err := a.AddLink(dir + "/fd/" + fd); err != nil {
+			return err
+		}
+
+		if err := a.AddFile(dir + "/fdinfo/" + fd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// captureSmaps captures dir/smaps_rollup or, on kernels lacking it, the much
+// larger dir/smaps.
+func captureSmaps(a *procfs.ArchiveWriter, fsys procfs.FS, dir string) error {
+	name := dir + "/smaps_rollup"
+	if _, err := fsys.Stat(name); os.IsNotExist(err) {
+		name = dir + "/smaps"
+	}
+
+	return a.AddFile(name)
+}
+
+// captureCgroups captures the files of the cgroups of pids read by the cgroup
+// descriptors (e.g., "memory_current").  The files of a cgroup are captured
+// once for all its processes.
+func captureCgroups(a *procfs.ArchiveWriter, fsys procfs.FS, pids []string) error {
+	// tells cgroup v2 from v1
+	if err := a.AddFile(filepath.Join(cgroups.CgroupRoot, "cgroup.controllers")); err != nil {
+		return errors.Wrap(err, "error capturing cgroup mode")
+	}
+
+	captured := make(map[string]bool)
+	for _, pid := range pids {
+		list, err := proc.ParseCgroups(fsys, pid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return errors.Wrapf(err, "error capturing cgroups of PID %s", pid)
+		}
+
+		for _, f := range cgroupFiles {
+			name, err := f.path(fsys, list)
+			if err != nil {
+				return err
+			}
+
+			if name == "" || captured[name] {
+				continue
+			}
+
+			captured[name] = true
+			if err := a.AddFile(name); err != nil {
+				return errors.Wrapf(err, "error capturing %s", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// captureNamespaces captures the namespace links in dir/ns.
+func captureNamespaces(a *procfs.ArchiveWriter, fsys procfs.FS, dir string) error {
+	namespaces, err := fsys.ReadDirNames(dir + "/ns")
+	if err != nil && !os.IsNotExist(err) && !os.IsPermission(err) {
+		return err
+	}
+
+	for _, ns := range namespaces {
+		if err := a.AddLink(dir + "/ns/" + ns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
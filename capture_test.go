@@ -0,0 +1,81 @@
+package ps
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestCaptureRoundTrip checks that the rows listed from an archive match the
+// ones of the live processes captured, with users and groups resolved by the
+// captured /etc.
+func TestCaptureRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	uid, gid := os.Geteuid(), os.Getegid()
+	etc := filepath.Join(dir, "etc")
+	if err := os.Mkdir(etc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	passwd := "captured:x:" + strconv.Itoa(uid) + ":" + strconv.Itoa(gid) + "::/:/bin/sh\n"
+	if err := ioutil.WriteFile(filepath.Join(etc, "passwd"), []byte(passwd), 0644); err != nil {
+		t.Fatal(err)
+	}
+	group := "capturedgroup:x:" + strconv.Itoa(gid) + ":\n"
+	if err := ioutil.WriteFile(filepath.Join(etc, "group"), []byte(group), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	descriptors := []string{"pid", "ppid", "user", "group", "comm", "args", "fdlimit"}
+	live := &ProcessInfoOpts{EtcRoot: etc}
+
+	var buf bytes.Buffer
+	before := time.Now()
+	if err := Capture(&buf, []string{pid}, live); err != nil {
+		t.Fatal(err)
+	}
+
+	liveRows, err := ProcessRowsByPidsWithOptions([]string{pid}, descriptors, live)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "capture.tar.gz")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := OpenArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Time().Before(before.Truncate(time.Second)) || archive.Time().After(time.Now()) {
+		t.Errorf("archive time %v is not the time of the capture", archive.Time())
+	}
+
+	rows, err := ProcessRowsWithOptions(descriptors, &ProcessInfoOpts{Archive: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || len(liveRows) != 1 {
+		t.Fatalf("got %d archived and %d live rows, want 1", len(rows), len(liveRows))
+	}
+
+	if rows[0]["user"] != "captured" || rows[0]["group"] != "capturedgroup" {
+		t.Errorf("got user %v and group %v, want the captured ones", rows[0]["user"], rows[0]["group"])
+	}
+	for _, d := range descriptors {
+		if rows[0][d] != liveRows[0][d] {
+			t.Errorf("%s: got %v from the archive, want %v", d, rows[0][d], liveRows[0][d])
+		}
+	}
+}
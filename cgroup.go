@@ -0,0 +1,327 @@
+package ps
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scmn-dev/ps/internal/cgroups"
+	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/process"
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// processCGROUP returns the path of the cgroup of process p.
+func processCGROUP(p *process.Process, ctx *psContext) (interface{}, error) {
+	return proc.Path(p.Cgroups), nil
+}
+
+// processCONTAINERID returns the ID of the container of process p or an empty
+// string if it doesn't run in a container.
+func processCONTAINERID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return proc.DetectContainer(p.Cgroups).ID, nil
+}
+
+// processCONTAINERRUNTIME returns the engine running the container of process
+// p (e.g., "docker" or "podman").
+func processCONTAINERRUNTIME(p *process.Process, ctx *psContext) (interface{}, error) {
+	return proc.DetectContainer(p.Cgroups).Runtime, nil
+}
+
+// formatContainerID abbreviates the 64-digit IDs of containers to 12 digits
+// like `docker ps` and renders processes outside of containers as "-".
+func formatContainerID(value interface{}) string {
+	id, ok := value.(string)
+	switch {
+	case !ok:
+		return formatValue(value)
+	case id == "":
+		return "-"
+	case len(id) == 64:
+		return id[:12]
+	default:
+		return id
+	}
+}
+
+// cgroupFile is a file of a cgroup controller, which is named v2 with cgroup
+// v2 and v1 with cgroup v1.
+type cgroupFile struct {
+	controller string
+	v2, v1     string
+}
+
+// The files read by the cgroup resource descriptors.
+var (
+	cgroupMemoryCurrent = cgroupFile{"memory", "memory.current", "memory.usage_in_bytes"}
+	cgroupMemoryMax     = cgroupFile{"memory", "memory.max", "memory.limit_in_bytes"}
+	cgroupMemoryEvents  = cgroupFile{"memory", "memory.events", "memory.oom_control"}
+	cgroupCPUMax        = cgroupFile{"cpu", "cpu.max", "cpu.cfs_quota_us"}
+	cgroupCPUPeriod     = cgroupFile{"cpu", "", "cpu.cfs_period_us"}
+	cgroupCPUStat       = cgroupFile{"cpu", "cpu.stat", "cpu.stat"}
+	cgroupPidsCurrent   = cgroupFile{"pids", "pids.current", "pids.current"}
+	cgroupPidsMax       = cgroupFile{"pids", "pids.max", "pids.max"}
+
+	// cgroupFiles are all files read by the cgroup resource descriptors.
+	cgroupFiles = []cgroupFile{
+		cgroupMemoryCurrent,
+		cgroupMemoryMax,
+		cgroupMemoryEvents,
+		cgroupCPUMax,
+		cgroupCPUPeriod,
+		cgroupCPUStat,
+		cgroupPidsCurrent,
+		cgroupPidsMax,
+	}
+)
+
+// cgroupV1Unlimited is the smallest value of memory.limit_in_bytes denoting
+// no limit, which is the largest multiple of the page size below 2^63.
+const cgroupV1Unlimited = 1 << 62
+
+// path returns the path of f of the cgroup in list or an empty string if the
+// controller isn't bound to a hierarchy.
+func (f cgroupFile) path(fsys procfs.FS, list []proc.Cgroup) (string, error) {
+	unified, err := cgroups.IsCgroup2UnifiedMode(fsys)
+	if err != nil {
+		return "", err
+	}
+
+	name := f.v1
+	if unified {
+		name = f.v2
+	}
+
+	dir := proc.ControllerPath(list, f.controller, unified)
+	if dir == "" || name == "" {
+		return "", nil
+	}
+
+	return filepath.Join(cgroups.CgroupRoot, dir, name), nil
+}
+
+// cgroupCache caches the files of cgroups read during a listing, which all
+// processes of a cgroup share.
+type cgroupCache map[string]cgroupRead
+
+type cgroupRead struct {
+	data string
+	err  error
+}
+
+// read returns the content of f of the cgroup of process p.  It returns
+// false if the file doesn't exist (e.g., if the controller isn't enabled for
+// the cgroup).
+func (c *cgroupCache) read(fsys procfs.FS, p *process.Process, f cgroupFile) (string, bool, error) {
+	name, err := f.path(fsys, p.Cgroups)
+	if err != nil || name == "" {
+		return "", false, err
+	}
+
+	r, ok := (*c)[name]
+	if !ok {
+		data, err := fsys.ReadFile(name)
+		r = cgroupRead{strings.TrimSpace(string(data)), err}
+		if *c == nil {
+			*c = make(cgroupCache)
+		}
+		(*c)[name] = r
+	}
+
+	if r.err != nil {
+		if os.IsNotExist(r.err) {
+			return "", false, nil
+		}
+
+		return "", false, r.err
+	}
+
+	return r.data, true, nil
+}
+
+// cgroupKey returns the value of key in the flat keyed file data (e.g.,
+// memory.events or cpu.stat).
+func cgroupKey(data, key string) (uint64, bool) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			value, err := strconv.ParseUint(fields[1], 10, 64)
+			return value, err == nil
+		}
+	}
+
+	return 0, false
+}
+
+// processCgroupUint returns a valueFunc parsing f of the cgroup of a process
+// as a single number.  Limits that aren't set are Unlimited.
+func processCgroupUint(f cgroupFile) valueFunc {
+	return func(p *process.Process, ctx *psContext) (interface{}, error) {
+		data, ok, err := ctx.cgroups.read(ctx.fsys, p, f)
+		if err != nil || !ok {
+			return nil, err
+		}
+
+		if data == "max" {
+			return Unlimited, nil
+		}
+
+		value, err := strconv.ParseUint(data, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s of PID %s", f.v2, p.Pid)
+		}
+
+		if f == cgroupMemoryMax && value >= cgroupV1Unlimited {
+			return Unlimited, nil
+		}
+
+		return value, nil
+	}
+}
+
+// processCgroupKey returns a valueFunc extracting the key of f of the cgroup
+// of a process, which is keyV2 with cgroup v2 and keyV1 with cgroup v1.
+func processCgroupKey(f cgroupFile, keyV2, keyV1 string) valueFunc {
+	return func(p *process.Process, ctx *psContext) (interface{}, error) {
+		data, ok, err := ctx.cgroups.read(ctx.fsys, p, f)
+		if err != nil || !ok {
+			return nil, err
+		}
+
+		unified, err := cgroups.IsCgroup2UnifiedMode(ctx.fsys)
+		if err != nil {
+			return nil, err
+		}
+
+		key := keyV1
+		if unified {
+			key = keyV2
+		}
+
+		value, ok := cgroupKey(data, key)
+		if !ok {
+			return nil, nil
+		}
+
+		return value, nil
+	}
+}
+
+// processCgroupMemoryCurrent returns the memory used by the cgroup of process
+// p in bytes.
+var processCgroupMemoryCurrent = processCgroupUint(cgroupMemoryCurrent)
+
+// processCgroupMemoryMax returns the memory limit of the cgroup of process p
+// in bytes or Unlimited.
+var processCgroupMemoryMax = processCgroupUint(cgroupMemoryMax)
+
+// processCgroupPidsCurrent returns the number of tasks in the cgroup of
+// process p.
+var processCgroupPidsCurrent = processCgroupUint(cgroupPidsCurrent)
+
+// processCgroupPidsMax returns the limit of tasks in the cgroup of process p
+// or Unlimited.
+var processCgroupPidsMax = processCgroupUint(cgroupPidsMax)
+
+// processCgroupOOMKill returns how often the OOM killer killed a process of
+// the cgroup of process p.
+var processCgroupOOMKill = processCgroupKey(cgroupMemoryEvents, "oom_kill", "oom_kill")
+
+// processCgroupNrPeriods returns the number of CPU bandwidth enforcement
+// periods of the cgroup of process p.
+var processCgroupNrPeriods = processCgroupKey(cgroupCPUStat, "nr_periods", "nr_periods")
+
+// processCgroupNrThrottled returns the number of periods the cgroup of
+// process p was throttled in.
+var processCgroupNrThrottled = processCgroupKey(cgroupCPUStat, "nr_throttled", "nr_throttled")
+
+// processCgroupThrottledTime returns the total time the cgroup of process p
+// was throttled.
+func processCgroupThrottledTime(p *process.Process, ctx *psContext) (interface{}, error) {
+	unified, err := cgroups.IsCgroup2UnifiedMode(ctx.fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	// cgroup v2 counts microseconds and cgroup v1 nanoseconds
+	key, unit := "throttled_time", time.Nanosecond
+	if unified {
+		key, unit = "throttled_usec", time.Microsecond
+	}
+
+	value, err := processCgroupKey(cgroupCPUStat, key, key)(p, ctx)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	return time.Duration(value.(uint64)) * unit, nil
+}
+
+// processCgroupCPUMax returns the CPU bandwidth limit of the cgroup of process
+// p in CPUs (i.e., the quota divided by the period) or math.Inf(1) if the
+// bandwidth isn't limited.
+func processCgroupCPUMax(p *process.Process, ctx *psContext) (interface{}, error) {
+	data, ok, err := ctx.cgroups.read(ctx.fsys, p, cgroupCPUMax)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	// cgroup v2 has "$quota $period" in cpu.max and cgroup v1 the quota
+	// or -1 in cpu.cfs_quota_us and the period in cpu.cfs_period_us
+	fields := strings.Fields(data)
+	if len(fields) == 1 {
+		period, ok, err := ctx.cgroups.read(ctx.fsys, p, cgroupCPUPeriod)
+		if err != nil || !ok {
+			return nil, err
+		}
+		fields = append(fields, period)
+	}
+
+	if len(fields) != 2 {
+		return nil, errors.Errorf("unexpected CPU limit %q of PID %s", data, p.Pid)
+	}
+
+	if fields[0] == "max" || fields[0] == "-1" {
+		return math.Inf(1), nil
+	}
+
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing CPU quota of PID %s", p.Pid)
+	}
+
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period == 0 {
+		return nil, errors.Errorf("unexpected CPU period %q of PID %s", fields[1], p.Pid)
+	}
+
+	return quota / period, nil
+}
+
+// formatCPUs renders a number of CPUs with two decimals and an unlimited
+// CPU bandwidth as "max".
+func formatCPUs(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		if math.IsInf(f, 1) {
+			return "max"
+		}
+		return strconv.FormatFloat(f, 'f', 2, 64)
+	}
+
+	return formatValue(value)
+}
+
+// formatMax renders Unlimited as "max" like the files of cgroups, which is
+// also used for the resource limits of /proc/$pid/limits (e.g., "fdlimit")
+// so that all limits render and filter alike.
+func formatMax(value interface{}) string {
+	if v, ok := value.(uint64); ok && v == Unlimited {
+		return "max"
+	}
+
+	return formatValue(value)
+}
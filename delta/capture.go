@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/scmn-dev/ps"
+)
+
+// capture implements `delta capture [flags] FILE`, which archives the
+// processes to FILE (or stdout if FILE is "-") for offline listings via
+// -archive.
+func capture(args []string) {
+	flags := flag.NewFlagSet("capture", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s capture [flags] FILE\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	var (
+		pids     = flags.String("pids", "", "comma separated list of process IDs to capture (default: all)")
+		procRoot = flags.String("proc-root", "", "directory the host's /proc is mounted at (default: /proc)")
+		sysRoot  = flags.String("sys-root", "", "directory the host's /sys is mounted at (default: /sys)")
+		devRoot  = flags.String("dev-root", "", "directory the host's /dev is mounted at (default: /dev)")
+		etcRoot  = flags.String("etc-root", "", "directory of the host's /etc (default: /etc or, with -proc-root, the /etc of the host's init)")
+	)
+
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	var pidsList []string
+	if *pids != "" {
+		pidsList = strings.Split(*pids, ",")
+	}
+
+	opts := ps.ProcessInfoOpts{ProcRoot: *procRoot, SysRoot: *sysRoot, DevRoot: *devRoot, EtcRoot: *etcRoot}
+	if err := writeCapture(flags.Arg(0), pidsList, &opts); err != nil {
+		fmt.Fprintf(os.Stderr, "error capturing processes: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeCapture writes the capture to path, removing it again on errors.
+func writeCapture(path string, pids []string, opts *ps.ProcessInfoOpts) error {
+	if path == "-" {
+		return ps.Capture(os.Stdout, pids, opts)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := ps.Capture(f, pids, opts); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return f.Close()
+}
@@ -1,73 +1,227 @@
-package main
-
-import (
-	"flag"
-	"fmt"
-	"os"
-	"strings"
-	"text/tabwriter"
-
-	"github.com/scmn-dev/ps"
-	"github.com/sirupsen/logrus"
-)
-
-func main() {
-	var (
-		descriptors []string
-		pidsList    []string
-		data        [][]string
-		err         error
-
-		pids         = flag.String("pids", "", "comma separated list of process IDs to retrieve")
-		format       = flag.String("format", "", "ps(1) AIX format comma-separated string")
-		list         = flag.Bool("list", false, "list all supported descriptors")
-		join         = flag.Bool("join", false, "join namespace of provided pids (containers)")
-		fillMappings = flag.Bool("fill-mappings", false, "fill the UID and GID mappings with the current user namespace")
-	)
-
-	flag.Parse()
-
-	if *fillMappings && !*join {
-		fmt.Fprintln(os.Stderr, "-fill-mappings requires -join")
-		os.Exit(1)
-	}
-
-	if *list {
-		fmt.Println(strings.Join(ps.ListDescriptors(), ", "))
-		return
-	}
-
-	if *format != "" {
-		descriptors = strings.Split(*format, ",")
-	}
-
-	if *pids != "" {
-		pidsList = strings.Split(*pids, ",")
-	}
-
-	if len(pidsList) > 0 {
-		opts := ps.JoinNamespaceOpts{FillMappings: *fillMappings}
-
-		if *join {
-			data, err = ps.JoinNamespaceAndProcessInfoByPidsWithOptions(pidsList, descriptors, &opts)
-		} else {
-			data, err = ps.ProcessInfoByPids(pidsList, descriptors)
-		}
-
-		if err != nil {
-			logrus.Panic(err)
-		}
-	} else {
-		data, err = ps.ProcessInfo(descriptors)
-		if err != nil {
-			logrus.Panic(err)
-		}
-	}
-
-	tw := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
-	for _, d := range data {
-		fmt.Fprintln(tw, strings.Join(d, "\t"))
-	}
-
-	tw.Flush()
-}
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scmn-dev/ps"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	var (
+		descriptors []string
+		pidsList    []string
+		err         error
+		formats     formatList
+
+		pids         = flag.String("pids", "", "comma separated list of process IDs to retrieve")
+		list         = flag.Bool("list", false, "list all supported descriptors")
+		join         = flag.Bool("join", false, "join namespace of provided pids (containers)")
+		fillMappings = flag.Bool("fill-mappings", false, "fill the UID and GID mappings with the current user namespace")
+		output       = flag.String("output", outputTable, "output format ("+strings.Join(outputFormats, ", ")+")")
+		noHeaders    = flag.Bool("no-headers", false, "omit the header line of the table output")
+		filterSpec   = flag.String("filter", "", "filter expression selecting processes (e.g., 'user == \"root\" && rss > 100MiB')")
+		threads      = flag.Bool("threads", false, "list threads instead of processes (like ps -L)")
+		tree         = flag.Bool("tree", false, "nest processes under their parents")
+		treeStyle    = flag.String("tree-style", "ascii", "style of the branches drawn by -tree (ascii, unicode)")
+		watchEvery   = flag.Duration("watch", 0, "refresh the listing at the specified interval (e.g., 2s) and report per-interval CPU usage")
+		interval     = flag.Duration("interval", 0, "list twice with the specified interval (e.g., 1s) and report per-interval CPU usage and I/O rates of the second listing")
+		redraw       = flag.Bool("redraw", false, "clear the screen before each refresh of -watch")
+		summary      = flag.Bool("summary", false, "print a summary header before each refresh of -watch")
+		concurrency  = flag.Int("concurrency", 0, "maximum number of processes parsed in parallel (default: number of CPUs)")
+		timeout      = flag.Duration("timeout", 0, "abort extracting processes after the specified duration (e.g., 5s) and print the partial listing")
+		units        = flag.String("units", "kib", "unit of memory descriptors such as rss in the table output (kib, mib, gib, human)")
+		sortSpec     = flag.String("sort", "", "comma separated list of descriptors to sort by, prefix with - for descending order (e.g., -rss,pid)")
+		procRoot     = flag.String("proc-root", "", "directory the host's /proc is mounted at (default: /proc)")
+		sysRoot      = flag.String("sys-root", "", "directory the host's /sys is mounted at (default: /sys)")
+		devRoot      = flag.String("dev-root", "", "directory the host's /dev is mounted at (default: /dev)")
+		etcRoot      = flag.String("etc-root", "", "directory of the host's /etc (default: /etc or, with -proc-root, the /etc of the host's init)")
+		archive      = flag.String("archive", "", "list the processes captured in the specified archive (see `delta capture`)")
+	)
+
+	flag.Var(&formats, "format", "comma separated list of descriptors, optionally with widths and headers (e.g., pid:8,user=OWNER), or AIX format string (e.g., '%p %U: %a'); may be repeated to append columns")
+
+	if len(os.Args) > 1 && os.Args[1] == "capture" {
+		capture(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "files" {
+		files(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "sockets" {
+		sockets(os.Args[2:])
+		return
+	}
+
+	if usesProcpsSyntax(os.Args[1:]) {
+		args, err := procpsFlags(os.Args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		flag.CommandLine.Parse(args)
+	} else {
+		flag.Parse()
+	}
+
+	if *fillMappings && !*join {
+		fmt.Fprintln(os.Stderr, "-fill-mappings requires -join")
+		os.Exit(1)
+	}
+
+	if !validOutputFormat(*output) {
+		fmt.Fprintf(os.Stderr, "unknown -output %q (supported: %s)\n", *output, strings.Join(outputFormats, ", "))
+		os.Exit(1)
+	}
+
+	if (*redraw || *summary) && *watchEvery <= 0 {
+		fmt.Fprintln(os.Stderr, "-redraw and -summary require -watch")
+		os.Exit(1)
+	}
+
+	if *interval > 0 && *watchEvery > 0 {
+		fmt.Fprintln(os.Stderr, "-interval cannot be combined with -watch")
+		os.Exit(1)
+	}
+
+	if *archive != "" && (*join || *watchEvery > 0 || *interval > 0) {
+		fmt.Fprintln(os.Stderr, "-archive cannot be combined with -join, -watch or -interval")
+		os.Exit(1)
+	}
+
+	if *list {
+		fmt.Println(strings.Join(ps.ListDescriptors(), ", "))
+		return
+	}
+
+	opts := ps.ProcessInfoOpts{
+		Threads:     *threads,
+		Concurrency: *concurrency,
+		ProcRoot:    *procRoot,
+		SysRoot:     *sysRoot,
+		DevRoot:     *devRoot,
+		EtcRoot:     *etcRoot,
+	}
+	if *sortSpec != "" {
+		opts.SortKeys, err = ps.ParseSortKeys(*sortSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -sort: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *tree {
+		opts.Tree, err = ps.ParseTreeStyle(*treeStyle)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -tree-style: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *filterSpec != "" {
+		opts.Filter, err = ps.ParseFilter(*filterSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -filter: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *archive != "" {
+		opts.Archive, err = ps.OpenArchive(*archive)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if len(formats) > 0 {
+		if _, err := ps.ParseFormat(formats...); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -format: %v\n", err)
+			os.Exit(1)
+		}
+		descriptors = formats
+	}
+
+	unit, err := ps.ParseUnit(*units)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -units: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *pids != "" {
+		pidsList = strings.Split(*pids, ",")
+	}
+
+	collect := func() ([]ps.Row, error) {
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		var (
+			data []ps.Row
+			err  error
+		)
+		if len(pidsList) == 0 {
+			data, err = ps.ProcessRowsWithOptionsContext(ctx, descriptors, &opts)
+		} else if *join {
+			joinOpts := ps.JoinNamespaceOpts{FillMappings: *fillMappings, ProcessInfoOpts: opts}
+			data, err = ps.JoinNamespaceAndProcessRowsByPidsWithOptionsContext(ctx, pidsList, descriptors, &joinOpts)
+		} else {
+			data, err = ps.ProcessRowsByPidsWithOptionsContext(ctx, pidsList, descriptors, &opts)
+		}
+
+		// print what could be extracted before the timeout
+		if _, ok := err.(*ps.TimeoutError); ok {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			return data, nil
+		}
+
+		return data, err
+	}
+
+	write := func(data []ps.Row) error {
+		renderOpts := renderOptions{unit: unit, header: !*noHeaders, now: time.Now()}
+		if opts.Archive != nil {
+			renderOpts.now = opts.Archive.Time()
+		}
+
+		return writeOutput(os.Stdout, *output, descriptors, data, renderOpts)
+	}
+
+	if *watchEvery > 0 {
+		opts.Sampler = ps.NewSampler()
+		if err := watch(*watchEvery, *redraw, *summary, opts.Sampler, collect, write); err != nil {
+			logrus.Panic(err)
+		}
+		return
+	}
+
+	if *interval > 0 {
+		// the first listing only samples the processes
+		opts.Sampler = ps.NewSampler()
+		if _, err := collect(); err != nil {
+			logrus.Panic(err)
+		}
+		time.Sleep(*interval)
+	}
+
+	data, err := collect()
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	if err := write(data); err != nil {
+		logrus.Panic(err)
+	}
+}
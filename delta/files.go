@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/scmn-dev/ps"
+)
+
+// listOutputFormats lists all values supported by the -output flag of
+// `delta files` and `delta sockets`.
+var listOutputFormats = []string{outputTable, outputJSON, outputNDJSON}
+
+// files implements `delta files [flags]`, which lists the open file
+// descriptors of processes similar to lsof.
+func files(args []string) {
+	flags := flag.NewFlagSet("files", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s files [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	var (
+		pids     = flags.String("pids", "", "comma separated list of process IDs (default: all)")
+		join     = flags.Bool("join", false, "resolve the paths in the mount namespace of each process (requires -pids)")
+		output   = flags.String("output", outputTable, "output format ("+strings.Join(listOutputFormats, ", ")+")")
+		timeout  = flags.Duration("timeout", 0, "abort listing files after the specified duration (e.g., 5s) and print the partial listing")
+		procRoot = flags.String("proc-root", "", "directory the host's /proc is mounted at (default: /proc)")
+		sysRoot  = flags.String("sys-root", "", "directory the host's /sys is mounted at (default: /sys)")
+		devRoot  = flags.String("dev-root", "", "directory the host's /dev is mounted at (default: /dev)")
+		etcRoot  = flags.String("etc-root", "", "directory of the host's /etc (default: /etc or, with -proc-root, the /etc of the host's init)")
+		archive  = flags.String("archive", "", "list the files captured in the specified archive (see `delta capture`)")
+	)
+
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	valid := false
+	for _, f := range listOutputFormats {
+		valid = valid || f == *output
+	}
+	if !valid {
+		fmt.Fprintf(os.Stderr, "unknown -output %q (supported: %s)\n", *output, strings.Join(listOutputFormats, ", "))
+		os.Exit(1)
+	}
+
+	var pidsList []string
+	if *pids != "" {
+		pidsList = strings.Split(*pids, ",")
+	}
+
+	if *join && (len(pidsList) == 0 || *archive != "") {
+		fmt.Fprintln(os.Stderr, "-join requires -pids and cannot be combined with -archive")
+		os.Exit(1)
+	}
+
+	opts := ps.ProcessInfoOpts{ProcRoot: *procRoot, SysRoot: *sysRoot, DevRoot: *devRoot, EtcRoot: *etcRoot}
+	if *archive != "" {
+		var err error
+		opts.Archive, err = ps.OpenArchive(*archive)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var (
+		list []ps.File
+		err  error
+	)
+	if *join {
+		list, err = ps.JoinNamespaceAndFilesByPidsContext(ctx, pidsList, &ps.JoinNamespaceOpts{ProcessInfoOpts: opts})
+	} else {
+		list, err = ps.FilesByPidsContext(ctx, pidsList, &opts)
+	}
+
+	// print what could be listed before the timeout
+	if _, ok := err.(*ps.TimeoutError); ok {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error listing files: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := writeFiles(os.Stdout, *output, list); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// fileObject is the JSON encoding of a ps.File.
+type fileObject struct {
+	PID    int    `json:"pid"`
+	FD     int    `json:"fd"`
+	Type   string `json:"type"`
+	Flags  string `json:"flags"`
+	Pos    int64  `json:"pos"`
+	Target string `json:"target"`
+}
+
+// writeFiles writes list to w in the specified output format.
+func writeFiles(w io.Writer, format string, list []ps.File) error {
+	objects := []fileObject{}
+	for _, f := range list {
+		objects = append(objects, fileObject{PID: f.PID, FD: f.FD, Type: f.Type, Flags: f.Flags, Pos: f.Pos, Target: f.Target})
+	}
+
+	switch format {
+	case outputJSON:
+		return json.NewEncoder(w).Encode(objects)
+	case outputNDJSON:
+		enc := json.NewEncoder(w)
+		for _, o := range objects {
+			if err := enc.Encode(o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	table := [][]string{{"PID", "FD", "TYPE", "FLAGS", "POS", "TARGET"}}
+	for _, f := range list {
+		table = append(table, []string{strconv.Itoa(f.PID), strconv.Itoa(f.FD), f.Type, f.Flags, strconv.FormatInt(f.Pos, 10), f.Target})
+	}
+
+	return writeColumns(w, table)
+}
+
+// writeColumns writes table with its columns aligned.
+func writeColumns(w io.Writer, table [][]string) error {
+	widths := make([]int, len(table[0]))
+	for _, row := range table {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for _, row := range table {
+		var b strings.Builder
+		for i, cell := range row {
+			b.WriteString(cell)
+			if i < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+3))
+			}
+		}
+		if _, err := fmt.Fprintln(w, b.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/scmn-dev/ps"
+)
+
+// schemaVersion is the version of the JSON document written by `-output json`.
+// It must be incremented on incompatible changes to the document's layout or
+// to the encoding of values.
+const schemaVersion = 1
+
+const (
+	outputTable  = "table"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputCSV    = "csv"
+)
+
+// outputFormats lists all values supported by the -output flag.
+var outputFormats = []string{outputTable, outputJSON, outputNDJSON, outputCSV}
+
+// validOutputFormat returns true if format is supported by the -output flag.
+func validOutputFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonDocument is the document written by `-output json`.
+type jsonDocument struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	Descriptors   []string                 `json:"descriptors"`
+	Processes     []map[string]interface{} `json:"processes"`
+}
+
+// formatList is the value of the -format flag, which may be repeated to
+// append columns.
+type formatList []string
+
+// String implements flag.Value.
+func (l *formatList) String() string {
+	return strings.Join(*l, " ")
+}
+
+// Set implements flag.Value.
+func (l *formatList) Set(spec string) error {
+	*l = append(*l, spec)
+	return nil
+}
+
+// renderOptions are the options of the output formats rendering values as
+// strings.
+type renderOptions struct {
+	// unit is the unit memory is rendered in by the table, while the
+	// other formats keep KiB or bytes.
+	unit ps.Unit
+	// header precedes the table by a header line.
+	header bool
+	// now is the time of the listing, relative to which times such as
+	// "stime" are rendered.
+	now time.Time
+}
+
+// writeOutput writes rows to w in the specified output format.
+func writeOutput(w io.Writer, format string, descriptors []string, rows []ps.Row, opts renderOptions) error {
+	switch format {
+	case outputTable:
+		return writeTable(w, descriptors, rows, opts)
+	case outputCSV:
+		return writeCSV(w, descriptors, rows, opts.now)
+	case outputJSON:
+		return writeJSON(w, descriptors, rows)
+	case outputNDJSON:
+		return writeNDJSON(w, descriptors, rows)
+	default:
+		return fmt.Errorf("unknown output format %q (supported: %s)", format, strings.Join(outputFormats, ", "))
+	}
+}
+
+// writeTable writes rows as lines rendered by the format of descriptors.
+func writeTable(w io.Writer, descriptors []string, rows []ps.Row, opts renderOptions) error {
+	if len(descriptors) == 0 {
+		descriptors = ps.DefaultDescriptors
+	}
+
+	f, err := ps.ParseFormat(descriptors...)
+	if err != nil {
+		return err
+	}
+	f.SetUnit(opts.unit)
+	f.SetHeader(opts.header)
+	f.SetTime(opts.now)
+
+	for _, line := range f.Render(rows) {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeCSV writes rows listed at now as RFC 4180 CSV with the headers as the
+// first record.
+func writeCSV(w io.Writer, descriptors []string, rows []ps.Row, now time.Time) error {
+	data, err := ps.RenderRowsAt(descriptors, rows, now)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if err := cw.WriteAll(data); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+// writeJSON writes rows as a single jsonDocument.
+func writeJSON(w io.Writer, descriptors []string, rows []ps.Row) error {
+	names, err := ps.DescriptorNames(descriptors)
+	if err != nil {
+		return err
+	}
+
+	doc := jsonDocument{
+		SchemaVersion: schemaVersion,
+		Descriptors:   names,
+		Processes:     []map[string]interface{}{},
+	}
+	for _, row := range rows {
+		doc.Processes = append(doc.Processes, jsonObject(names, row))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// writeNDJSON writes one JSON object per process and line.
+func writeNDJSON(w io.Writer, descriptors []string, rows []ps.Row) error {
+	names, err := ps.DescriptorNames(descriptors)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := enc.Encode(jsonObject(names, row)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jsonObject returns the JSON representation of row keyed by descriptor name.
+func jsonObject(names []string, row ps.Row) map[string]interface{} {
+	obj := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		obj[name] = jsonValue(row[name])
+	}
+
+	return obj
+}
+
+// jsonValue converts a typed row value into a value with a stable JSON
+// encoding: durations are encoded as (fractional) seconds, times in RFC 3339,
+// capability sets as lists of names and, as JSON lacks infinity and NaN,
+// limits that aren't set (see ps.Row) and undefined numbers as null.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil
+		}
+		return v
+	case uint64:
+		if v == ps.Unlimited {
+			return nil
+		}
+		return v
+	case time.Duration:
+		return v.Seconds()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case ps.CapSet:
+		return v.Names()
+	default:
+		return v
+	}
+}
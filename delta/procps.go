@@ -0,0 +1,558 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/scmn-dev/ps"
+)
+
+// Format presets of the UNIX and BSD option styles of procps-ng.
+var (
+	unixDefaultFormat = []string{"pid", "tty", "time", "ucmd"}
+	unixFullFormat    = []string{"user=UID", "pid", "ppid", "c", "stime", "tty", "time", "cmd"}
+	unixExtraFormat   = []string{"user=UID", "pid", "ppid", "c", "sz", "rss", "psr", "stime", "tty", "time", "cmd"}
+	unixLongFormat    = []string{"f", "s", "uid", "pid", "ppid", "c", "pri", "ni", "sz", "wchan", "tty", "time", "ucmd"}
+	unixLongFull      = []string{"f", "s", "user=UID", "pid", "ppid", "c", "pri", "ni", "sz", "wchan", "stime", "tty", "time", "cmd"}
+	unixJobsFormat    = []string{"pid", "pgid", "sid", "tty", "time", "ucmd"}
+	unixJobsFull      = []string{"user=UID", "pid", "ppid", "pgid", "sid", "c", "stime", "tty", "time", "cmd"}
+
+	bsdDefaultFormat = []string{"pid", "tty", "stat", "time", "command"}
+	bsdUserFormat    = []string{"user", "pid", "%cpu", "%mem", "vsz", "rss", "tty", "stat", "stime=START", "time", "command"}
+	bsdVMFormat      = []string{"pid", "tty", "stat", "time", "majflt=MAJFL", "rss", "%mem", "command"}
+	bsdJobsFormat    = []string{"ppid", "pid", "pgid", "sid", "tty", "tpgid", "stat", "uid", "time", "command"}
+	bsdLongFormat    = []string{"f", "uid", "pid", "ppid", "pri", "ni", "vsz", "rss", "wchan", "stat", "tty", "time", "command"}
+)
+
+// procpsArgs collects the options of a procps-ng command line.
+type procpsArgs struct {
+	// bsd is set if any BSD option was given, which changes the default
+	// selection and format.
+	bsd bool
+
+	// all selects every process (-e, -A or BSD "ax").
+	all bool
+	// bsdAll and bsdNoTTY lift the BSD restrictions to processes of the
+	// current user and with a terminal ("a" and "x").
+	bsdAll   bool
+	bsdNoTTY bool
+	// selections are the filter clauses of the selection options, which
+	// select the union of their processes.
+	selections []string
+	// restrictions are filter clauses all selected processes must match.
+	restrictions []string
+	negate       bool
+
+	full, extra, long, jobs bool
+	bsdFormat               []string
+	custom                  []string
+	noHeaders               bool
+
+	threads bool
+	tree    bool
+	sort    []string
+}
+
+// usesProcpsSyntax returns true if delta runs as `ps` or args contain an
+// option that isn't one of delta's flags (e.g., "-ef" or "aux"), which may
+// follow delta's flags (e.g., "--sort=-rss -e").
+func usesProcpsSyntax(args []string) bool {
+	if filepath.Base(os.Args[0]) == "ps" {
+		return true
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			// delta's flags end here
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return true
+		}
+
+		name, hasValue := strings.TrimLeft(arg, "-"), false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, hasValue = name[:j], true
+		}
+		if name == "" {
+			return true
+		}
+		if name == "h" || name == "help" {
+			return false
+		}
+
+		f := flag.Lookup(name)
+		if f == nil {
+			return true
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !hasValue && !(ok && b.IsBoolFlag()) {
+			// skip the value of the flag
+			i++
+		}
+	}
+
+	return false
+}
+
+// procpsFlags translates the procps-ng command line args to delta's flags.
+func procpsFlags(args []string) ([]string, error) {
+	p := procpsArgs{}
+	if err := p.parse(args); err != nil {
+		return nil, err
+	}
+
+	flags := []string{}
+	for _, spec := range p.format() {
+		flags = append(flags, "-format", spec)
+	}
+	if p.noHeaders {
+		flags = append(flags, "-no-headers")
+	}
+
+	filter, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		flags = append(flags, "-filter", filter)
+	}
+
+	if len(p.sort) > 0 {
+		flags = append(flags, "-sort", strings.Join(p.sort, ","))
+	}
+	if p.threads {
+		flags = append(flags, "-threads")
+	}
+	if p.tree {
+		flags = append(flags, "-tree")
+	}
+
+	return flags, nil
+}
+
+// parse parses the UNIX ("-ef"), BSD ("aux") and GNU ("--pid 1") options
+// in args.
+func (p *procpsArgs) parse(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// next returns the argument of an option, which is either the rest
+		// of the current argument or the next one
+		next := func(rest, opt string) (string, error) {
+			if rest != "" {
+				return rest, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option %s requires an argument", opt)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := arg[2:], "", false
+			if j := strings.Index(name, "="); j >= 0 {
+				name, value, hasValue = name[:j], name[j+1:], true
+			}
+			err = p.parseGNU(name, value, hasValue, func() (string, error) {
+				return next("", "--"+name)
+			})
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			err = p.parseCluster(arg[1:], false, next)
+		case isNumberList(arg):
+			// BSD also accepts bare process IDs
+			p.bsd = true
+			p.selections = append(p.selections, idClause("pid", "", splitList(arg)))
+		default:
+			err = p.parseCluster(arg, true, next)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseGNU parses the long option name.
+func (p *procpsArgs) parseGNU(name, value string, hasValue bool, next func() (string, error)) error {
+	arg := func() (string, error) {
+		if hasValue {
+			return value, nil
+		}
+		return next()
+	}
+
+	var clause func(string) (string, error)
+	switch name {
+	case "pid":
+		clause = func(list string) (string, error) { return idClause("pid", "", splitList(list)), nil }
+	case "ppid":
+		clause = func(list string) (string, error) { return idClause("ppid", "", splitList(list)), nil }
+	case "sid":
+		clause = func(list string) (string, error) { return idClause("sid", "", splitList(list)), nil }
+	case "user":
+		clause = func(list string) (string, error) { return idClause("uid", "user", splitList(list)), nil }
+	case "User":
+		clause = func(list string) (string, error) { return idClause("ruid", "ruser", splitList(list)), nil }
+	case "group":
+		clause = func(list string) (string, error) { return idClause("gid", "group", splitList(list)), nil }
+	case "Group":
+		clause = func(list string) (string, error) { return idClause("rgid", "rgroup", splitList(list)), nil }
+	case "tty":
+		clause = func(list string) (string, error) { return ttyClause(splitList(list)), nil }
+	case "format":
+		f, err := arg()
+		if err != nil {
+			return err
+		}
+		p.custom = append(p.custom, f)
+		return nil
+	case "sort":
+		s, err := arg()
+		if err != nil {
+			return err
+		}
+		p.sort = append(p.sort, s)
+		return nil
+	case "forest":
+		p.tree = true
+		return nil
+	case "no-headers", "no-heading":
+		p.noHeaders = true
+		return nil
+	case "headers", "heading":
+		p.noHeaders = false
+		return nil
+	case "deselect":
+		p.negate = true
+		return nil
+	default:
+		return fmt.Errorf("unsupported option --%s", name)
+	}
+
+	list, err := arg()
+	if err != nil {
+		return err
+	}
+	c, err := clause(list)
+	if err != nil {
+		return err
+	}
+	p.selections = append(p.selections, c)
+
+	return nil
+}
+
+// parseCluster parses a cluster of UNIX (e.g., "ef") or BSD (e.g., "aux")
+// options.  Options taking an argument consume the rest of the cluster or
+// the next argument.
+func (p *procpsArgs) parseCluster(cluster string, bsd bool, next func(rest, opt string) (string, error)) error {
+	if bsd {
+		p.bsd = true
+	}
+
+	for j, opt := range cluster {
+		rest := cluster[j+len(string(opt)):]
+		name := "-" + string(opt)
+		if bsd {
+			name = string(opt)
+		}
+
+		// selectBy adds a selection clause for the option's argument
+		selectBy := func(clause func([]string) string) error {
+			list, err := next(rest, name)
+			if err != nil {
+				return err
+			}
+			p.selections = append(p.selections, clause(splitList(list)))
+			return nil
+		}
+
+		var err error
+		switch {
+		// options taking an argument end the cluster
+		case opt == 'p' || opt == 'q' && !bsd:
+			return selectBy(func(ids []string) string { return idClause("pid", "", ids) })
+		case opt == 'u' && !bsd:
+			return selectBy(func(ids []string) string { return idClause("uid", "user", ids) })
+		case opt == 'U':
+			if bsd {
+				return selectBy(func(ids []string) string { return idClause("uid", "user", ids) })
+			}
+			return selectBy(func(ids []string) string { return idClause("ruid", "ruser", ids) })
+		case opt == 'g' && !bsd:
+			return selectBy(func(ids []string) string { return idClause("gid", "group", ids) })
+		case opt == 'G' && !bsd:
+			return selectBy(func(ids []string) string { return idClause("rgid", "rgroup", ids) })
+		case opt == 't' && (!bsd || rest != ""):
+			return selectBy(ttyClause)
+		case opt == 'C' && !bsd:
+			return selectBy(func(names []string) string { return listClause("comm", names) })
+		case opt == 's' && !bsd:
+			return selectBy(func(ids []string) string { return idClause("sid", "", ids) })
+		case opt == 'o':
+			f, err := next(rest, name)
+			if err != nil {
+				return err
+			}
+			p.custom = append(p.custom, f)
+			return nil
+		case opt == 'k' && bsd:
+			s, err := next(rest, name)
+			if err != nil {
+				return err
+			}
+			p.sort = append(p.sort, s)
+			return nil
+
+		// UNIX options
+		case !bsd && (opt == 'e' || opt == 'A'):
+			p.all = true
+		case !bsd && opt == 'a':
+			p.selections = append(p.selections, `(tty != "?" && pid != sid)`)
+		case !bsd && opt == 'd':
+			p.selections = append(p.selections, `pid != sid`)
+		case !bsd && opt == 'N':
+			p.negate = true
+		case !bsd && opt == 'f':
+			p.full = true
+		case !bsd && opt == 'F':
+			p.extra = true
+		case !bsd && opt == 'l':
+			p.long = true
+		case !bsd && opt == 'j':
+			p.jobs = true
+		case !bsd && (opt == 'L' || opt == 'T' || opt == 'm'):
+			p.threads = true
+		case !bsd && opt == 'H':
+			p.tree = true
+		case !bsd && (opt == 'w' || opt == 'y'):
+			// output is never truncated and -y only affects -l's ADDR
+
+		// BSD options
+		case bsd && opt == 'a':
+			p.bsdAll = true
+		case bsd && opt == 'x':
+			p.bsdNoTTY = true
+		case bsd && opt == 'u':
+			p.bsdFormat = bsdUserFormat
+		case bsd && opt == 'v':
+			p.bsdFormat = bsdVMFormat
+		case bsd && opt == 'j':
+			p.bsdFormat = bsdJobsFormat
+		case bsd && opt == 'l':
+			p.bsdFormat = bsdLongFormat
+		case bsd && opt == 'f':
+			p.tree = true
+		case bsd && opt == 'H':
+			p.threads = true
+		case bsd && opt == 'h':
+			p.noHeaders = true
+		case bsd && opt == 'r':
+			p.restrictions = append(p.restrictions, `state == "R"`)
+		case bsd && (opt == 'T' || opt == 't'):
+			tty, terr := ownTTY()
+			if terr != nil {
+				return terr
+			}
+			p.selections = append(p.selections, ttyClause([]string{tty}))
+		case bsd && (opt == 'w' || opt == 'e' || opt == 'c'):
+			// output is never truncated and the environment isn't shown
+		default:
+			err = fmt.Errorf("unsupported option %s", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// format returns the format specs selected by the format options.  The
+// arguments of -o are passed on unchanged, so their headers extend to the
+// end of the argument and AIX format strings (e.g., "%p %U: %a") are kept.
+func (p *procpsArgs) format() []string {
+	var format []string
+	switch {
+	case len(p.custom) > 0:
+		format = p.custom
+	case p.bsdFormat != nil:
+		format = p.bsdFormat
+	case p.long && (p.full || p.extra):
+		format = unixLongFull
+	case p.long:
+		format = unixLongFormat
+	case p.jobs && (p.full || p.extra):
+		format = unixJobsFull
+	case p.jobs:
+		format = unixJobsFormat
+	case p.extra:
+		format = unixExtraFormat
+	case p.full:
+		format = unixFullFormat
+	case p.bsd:
+		format = bsdDefaultFormat
+	default:
+		format = unixDefaultFormat
+	}
+	format = append([]string(nil), format...)
+
+	if p.threads && len(p.custom) == 0 {
+		format = insertAfter(format, "lwp", "ppid", "pid")
+		if p.full || p.extra {
+			format = insertAfter(format, "nlwp", "c")
+		}
+	}
+
+	return format
+}
+
+// filter returns the filter expression selecting the processes.
+func (p *procpsArgs) filter() (string, error) {
+	clauses := []string{}
+	switch {
+	case p.all:
+	case len(p.selections) > 0:
+		clauses = append(clauses, "("+strings.Join(p.selections, " || ")+")")
+	case p.bsd:
+		if !p.bsdAll {
+			clauses = append(clauses, fmt.Sprintf("uid == %d", os.Geteuid()))
+		}
+		if !p.bsdNoTTY {
+			clauses = append(clauses, `tty != "?"`)
+		}
+	default:
+		tty, err := ownTTY()
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, fmt.Sprintf("uid == %d", os.Geteuid()), "tty == "+strconv.Quote(tty))
+	}
+
+	filter := strings.Join(clauses, " && ")
+	if p.negate {
+		if filter == "" {
+			return "", fmt.Errorf("cannot deselect all processes")
+		}
+		filter = "!(" + filter + ")"
+	}
+
+	for _, r := range p.restrictions {
+		if filter != "" {
+			filter += " && "
+		}
+		filter += r
+	}
+
+	return filter, nil
+}
+
+// ownTTY returns the terminal of delta as rendered by the "tty" descriptor.
+func ownTTY() (string, error) {
+	rows, err := ps.ProcessRowsByPids([]string{strconv.Itoa(os.Getpid())}, []string{"tty"})
+	if err != nil {
+		return "", err
+	}
+
+	if len(rows) == 0 || rows[0]["tty"] == nil {
+		return "?", nil
+	}
+
+	return fmt.Sprint(rows[0]["tty"]), nil
+}
+
+// idClause returns a filter clause selecting processes whose descriptor id
+// is one of ids or, if name is set, whose descriptor name is one of the
+// non-numeric ids.
+func idClause(id, name string, ids []string) string {
+	numbers, names := []string{}, []string{}
+	for _, i := range ids {
+		if isNumberList(i) || name == "" {
+			numbers = append(numbers, i)
+		} else {
+			names = append(names, i)
+		}
+	}
+
+	clauses := []string{}
+	if len(numbers) > 0 {
+		clauses = append(clauses, listClause(id, numbers))
+	}
+	if len(names) > 0 {
+		clauses = append(clauses, listClause(name, names))
+	}
+
+	return strings.Join(clauses, " || ")
+}
+
+// ttyClause returns a filter clause selecting processes on one of ttys,
+// where "-" denotes processes without a terminal.
+func ttyClause(ttys []string) string {
+	names := []string{}
+	for _, tty := range ttys {
+		tty = strings.TrimPrefix(tty, "/dev/")
+		if tty == "-" {
+			tty = "?"
+		}
+		names = append(names, tty)
+	}
+
+	return listClause("tty", names)
+}
+
+// listClause returns a filter clause selecting processes whose descriptor
+// is one of values.
+func listClause(descriptor string, values []string) string {
+	quoted := []string{}
+	for _, v := range values {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+
+	return descriptor + " in (" + strings.Join(quoted, ", ") + ")"
+}
+
+// splitList splits a procps-ng list, which is separated by commas or
+// spaces.
+func splitList(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// isNumberList returns true if s is a non-empty list of numbers.
+func isNumberList(s string) bool {
+	items := splitList(s)
+	for _, item := range items {
+		if _, err := strconv.Atoi(item); err != nil {
+			return false
+		}
+	}
+
+	return len(items) > 0
+}
+
+// insertAfter inserts keyword after the first of anchors found in format.
+func insertAfter(format []string, keyword string, anchors ...string) []string {
+	for _, anchor := range anchors {
+		for i, k := range format {
+			if k != anchor {
+				continue
+			}
+
+			format = append(format[:i+1], append([]string{keyword}, format[i+1:]...)...)
+			return format
+		}
+	}
+
+	return format
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// delta's flags are defined in main, so the ones usesProcpsSyntax looks up
+// are registered here.
+func init() {
+	flag.String("format", "", "")
+	flag.String("sort", "", "")
+	flag.String("filter", "", "")
+	flag.Bool("tree", false, "")
+	flag.Bool("no-headers", false, "")
+}
+
+func TestUsesProcpsSyntax(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"-tree"}, false},
+		{[]string{"-format", "pid,comm", "-tree"}, false},
+		{[]string{"-sort", "-rss"}, false},
+		{[]string{"--sort=-rss"}, false},
+		{[]string{"-filter", "rss > 1M", "-no-headers"}, false},
+		{[]string{"-h"}, false},
+		{[]string{"-tree", "--", "-e"}, false},
+		{[]string{"-e"}, true},
+		{[]string{"-ef"}, true},
+		{[]string{"aux"}, true},
+		{[]string{"1234"}, true},
+		{[]string{"--sort=-rss", "-e"}, true},
+		{[]string{"-sort", "-rss", "-e"}, true},
+		{[]string{"-tree", "-p", "1"}, true},
+		{[]string{"-format", "pid", "aux"}, true},
+	}
+
+	for _, test := range tests {
+		if got := usesProcpsSyntax(test.args); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.args, got, test.want)
+		}
+	}
+}
+
+func TestProcpsFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			[]string{"-e"},
+			[]string{"-format", "pid", "-format", "tty", "-format", "time", "-format", "ucmd"},
+		},
+		{
+			[]string{"-ef"},
+			[]string{"-format", "user=UID", "-format", "pid", "-format", "ppid", "-format", "c", "-format", "stime", "-format", "tty", "-format", "time", "-format", "cmd"},
+		},
+		{
+			[]string{"aux"},
+			[]string{"-format", "user", "-format", "pid", "-format", "%cpu", "-format", "%mem", "-format", "vsz", "-format", "rss", "-format", "tty", "-format", "stat", "-format", "stime=START", "-format", "time", "-format", "command"},
+		},
+		{
+			[]string{"ax", "-o", "pid,comm"},
+			[]string{"-format", "pid,comm"},
+		},
+		{
+			[]string{"-p", "1,2"},
+			[]string{"-format", "pid", "-format", "tty", "-format", "time", "-format", "ucmd", "-filter", `(pid in ("1", "2"))`},
+		},
+		{
+			[]string{"--pid", "1", "-o", "pid=", "-o", "comm"},
+			[]string{"-format", "pid=", "-format", "comm", "-filter", `(pid in ("1"))`},
+		},
+		{
+			[]string{"-u", "root,1000"},
+			[]string{"-format", "pid", "-format", "tty", "-format", "time", "-format", "ucmd", "-filter", `(uid in ("1000") || user in ("root"))`},
+		},
+		{
+			[]string{"-t", "-,pts/0"},
+			[]string{"-format", "pid", "-format", "tty", "-format", "time", "-format", "ucmd", "-filter", `(tty in ("?", "pts/0"))`},
+		},
+		{
+			[]string{"-N", "-p", "1"},
+			[]string{"-format", "pid", "-format", "tty", "-format", "time", "-format", "ucmd", "-filter", `!((pid in ("1")))`},
+		},
+		{
+			[]string{"-e", "--sort=-rss"},
+			[]string{"-format", "pid", "-format", "tty", "-format", "time", "-format", "ucmd", "-sort", "-rss"},
+		},
+		{
+			[]string{"-eLf"},
+			[]string{"-format", "user=UID", "-format", "pid", "-format", "ppid", "-format", "lwp", "-format", "c", "-format", "nlwp", "-format", "stime", "-format", "tty", "-format", "time", "-format", "cmd", "-threads"},
+		},
+		{
+			[]string{"-e", "--forest", "--no-headers"},
+			[]string{"-format", "pid", "-format", "tty", "-format", "time", "-format", "ucmd", "-no-headers", "-tree"},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := procpsFlags(test.args)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestProcpsFlagsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-p"},
+		{"-ek"},
+		{"--sort"},
+		{"-N", "-e"},
+	} {
+		if _, err := procpsFlags(args); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
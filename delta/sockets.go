@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/scmn-dev/ps"
+)
+
+// sockets implements `delta sockets [flags]`, which lists the listening and
+// established sockets of processes similar to `ss -p`.
+func sockets(args []string) {
+	flags := flag.NewFlagSet("sockets", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s sockets [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	var (
+		pids     = flags.String("pids", "", "comma separated list of process IDs (default: all)")
+		all      = flags.Bool("all", false, "list sockets in all states instead of only listening and established ones")
+		unix     = flags.Bool("unix", false, "list unix sockets besides tcp and udp sockets")
+		output   = flags.String("output", outputTable, "output format ("+strings.Join(listOutputFormats, ", ")+")")
+		timeout  = flags.Duration("timeout", 0, "abort listing sockets after the specified duration (e.g., 5s) and print the partial listing")
+		procRoot = flags.String("proc-root", "", "directory the host's /proc is mounted at (default: /proc)")
+		sysRoot  = flags.String("sys-root", "", "directory the host's /sys is mounted at (default: /sys)")
+		devRoot  = flags.String("dev-root", "", "directory the host's /dev is mounted at (default: /dev)")
+		etcRoot  = flags.String("etc-root", "", "directory of the host's /etc (default: /etc or, with -proc-root, the /etc of the host's init)")
+		archive  = flags.String("archive", "", "list the sockets captured in the specified archive (see `delta capture`)")
+	)
+
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	valid := false
+	for _, f := range listOutputFormats {
+		valid = valid || f == *output
+	}
+	if !valid {
+		fmt.Fprintf(os.Stderr, "unknown -output %q (supported: %s)\n", *output, strings.Join(listOutputFormats, ", "))
+		os.Exit(1)
+	}
+
+	var pidsList []string
+	if *pids != "" {
+		pidsList = strings.Split(*pids, ",")
+	}
+
+	opts := ps.ProcessInfoOpts{ProcRoot: *procRoot, SysRoot: *sysRoot, DevRoot: *devRoot, EtcRoot: *etcRoot}
+	if *archive != "" {
+		var err error
+		opts.Archive, err = ps.OpenArchive(*archive)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	list, err := ps.SocketsByPidsContext(ctx, pidsList, &opts)
+
+	// print what could be listed before the timeout
+	if _, ok := err.(*ps.TimeoutError); ok {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error listing sockets: %v\n", err)
+		os.Exit(1)
+	}
+
+	selected := []ps.Socket{}
+	for _, s := range list {
+		if s.Proto == "unix" && !*unix {
+			continue
+		}
+
+		if *all || s.Listening() || s.State == "ESTAB" {
+			selected = append(selected, s)
+		}
+	}
+
+	if err := writeSockets(os.Stdout, *output, selected); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// socketObject is the JSON encoding of a ps.Socket.
+type socketObject struct {
+	Proto     string `json:"proto"`
+	State     string `json:"state"`
+	Local     string `json:"local"`
+	Remote    string `json:"remote"`
+	Inode     uint64 `json:"inode"`
+	PID       int    `json:"pid"`
+	User      string `json:"user"`
+	Container string `json:"container"`
+}
+
+// writeSockets writes list to w in the specified output format.
+func writeSockets(w io.Writer, format string, list []ps.Socket) error {
+	objects := []socketObject{}
+	for _, s := range list {
+		objects = append(objects, socketObject{Proto: s.Proto, State: s.State, Local: s.Local, Remote: s.Remote, Inode: s.Inode, PID: s.PID, User: s.User, Container: s.Container})
+	}
+
+	switch format {
+	case outputJSON:
+		return json.NewEncoder(w).Encode(objects)
+	case outputNDJSON:
+		enc := json.NewEncoder(w)
+		for _, o := range objects {
+			if err := enc.Encode(o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	table := [][]string{{"PROTO", "STATE", "LOCAL", "REMOTE", "PID", "USER", "CONTAINER"}}
+	for _, s := range list {
+		container := s.Container
+		// abbreviate the ID like `docker ps`
+		if len(container) > 12 {
+			container = container[:12]
+		}
+		table = append(table, []string{s.Proto, s.State, dash(s.Local), dash(s.Remote), strconv.Itoa(s.PID), s.User, dash(container)})
+	}
+
+	return writeColumns(w, table)
+}
+
+// dash returns s or "-" if s is empty.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/scmn-dev/ps"
+)
+
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\033[H\033[2J"
+
+// watch collects and writes the listing every interval until interrupted.
+func watch(interval time.Duration, redraw, summary bool, sampler *ps.Sampler, collect func() ([]ps.Row, error), write func([]ps.Row) error) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		data, err := collect()
+		if err != nil {
+			return err
+		}
+
+		if redraw {
+			fmt.Print(clearScreen)
+		}
+
+		if summary {
+			writeSummary(os.Stdout, sampler.Summary())
+		}
+
+		if err := write(data); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-sigs:
+			return nil
+		}
+	}
+}
+
+// stateNames maps process states to the names used in the summary header.
+var stateNames = map[string]string{
+	"R": "running",
+	"S": "sleeping",
+	"D": "uninterruptible",
+	"I": "idle",
+	"T": "stopped",
+	"t": "traced",
+	"Z": "zombie",
+}
+
+// writeSummary writes a top(1)-like summary header.
+func writeSummary(w io.Writer, s ps.Summary) {
+	uptime := s.Uptime.Truncate(time.Minute)
+	fmt.Fprintf(w, "delta - %s up %v, load average: %.2f, %.2f, %.2f\n",
+		s.Time.Format("15:04:05"), uptime, s.Load[0], s.Load[1], s.Load[2])
+
+	states := []string{}
+	for state := range s.States {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	counts := []string{}
+	for _, state := range states {
+		name, ok := stateNames[state]
+		if !ok {
+			name = state
+		}
+		counts = append(counts, fmt.Sprintf("%d %s", s.States[state], name))
+	}
+
+	fmt.Fprintf(w, "Processes: %d total, %s; CPU: %.1f%%\n\n", s.Processes, strings.Join(counts, ", "), s.CPU)
+}
@@ -0,0 +1,212 @@
+package ps
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/scmn-dev/ps/internal/process"
+)
+
+var (
+	// ErrInvalidDescriptor is returned when registering a malformed
+	// Descriptor.
+	ErrInvalidDescriptor = errors.New("invalid descriptor")
+
+	// ErrDescriptorExists is returned when registering a Descriptor whose
+	// name or code is already taken.
+	ErrDescriptorExists = errors.New("descriptor already exists")
+
+	// descriptorsMu guards aixFormatDescriptors against concurrent
+	// registrations.
+	descriptorsMu sync.RWMutex
+)
+
+// Descriptor is a custom descriptor registered via RegisterDescriptor.
+type Descriptor struct {
+	// Name is the name of the descriptor, which is also its key in a Row.
+	// It may consist of letters, digits and underscores.
+	Name string
+
+	// Code is an optional AIX format code (e.g., "%o") accepted in place
+	// of Name.
+	Code string
+
+	// Header is the header of the descriptor's column.  It defaults to
+	// the upper-case Name.
+	Header string
+
+	// OnHost passes the host process corresponding to each process in a
+	// joined namespace to Value.  Processes without a corresponding host
+	// process get a nil value.
+	OnHost bool
+
+	// Value returns the typed value of the descriptor for p.  A nil value
+	// is rendered as "?".  Only the status and command line of p are read
+	// upfront; the files of built-in descriptors are read when p.Value
+	// asks for them.
+	Value func(p *Process) (interface{}, error)
+
+	// Format optionally renders values as strings instead of the default
+	// formatting.
+	Format func(value interface{}) string
+}
+
+// RegisterDescriptor registers d, making it available to all listings,
+// filters, sort keys and ListDescriptors.  It is safe to call concurrently
+// with listings, but meant to be called during initialization.
+func RegisterDescriptor(d Descriptor) error {
+	if !validDescriptorName(d.Name) {
+		return errors.Wrapf(ErrInvalidDescriptor, "invalid name %q", d.Name)
+	}
+
+	if d.Code != "" && strings.ContainsAny(d.Code, ", \t") {
+		return errors.Wrapf(ErrInvalidDescriptor, "invalid code %q", d.Code)
+	}
+
+	if d.Value == nil {
+		return errors.Wrapf(ErrInvalidDescriptor, "'%s' has no value function", d.Name)
+	}
+
+	if d.Header == "" {
+		d.Header = strings.ToUpper(d.Name)
+	}
+
+	descriptorsMu.Lock()
+	defer descriptorsMu.Unlock()
+
+	for _, aix := range aixFormatDescriptors {
+		for _, taken := range []string{aix.normal, aix.code} {
+			if taken == "" {
+				continue
+			}
+			if taken == d.Name || taken == d.Code {
+				return errors.Wrapf(ErrDescriptorExists, "'%s'", taken)
+			}
+		}
+	}
+
+	for _, name := range []string{d.Name, d.Code} {
+		if _, ok := procpsAliases[name]; ok {
+			return errors.Wrapf(ErrDescriptorExists, "'%s'", name)
+		}
+	}
+
+	aixFormatDescriptors = append(aixFormatDescriptors, aixFormatDescriptor{
+		code:   d.Code,
+		normal: d.Name,
+		header: d.Header,
+		onHost: d.OnHost,
+		procFn: func(p *process.Process, ctx *psContext) (interface{}, error) {
+			if d.OnHost {
+				if p = findHostProcess(p, ctx); p == nil {
+					return nil, nil
+				}
+			}
+
+			return d.Value(&Process{p: p, ctx: ctx})
+		},
+		format: d.Format,
+		// other sources are parsed on demand by Process.Value
+		sources: process.SourceStatus | process.SourceCmdLine,
+	})
+
+	return nil
+}
+
+// validDescriptorName returns true if name is a valid descriptor name.
+func validDescriptorName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Process is a read-only view of a process passed to the value function of
+// a registered Descriptor.
+type Process struct {
+	p   *process.Process
+	ctx *psContext
+}
+
+// PID returns the process ID.
+func (p *Process) PID() int {
+	pid, _ := strconv.Atoi(p.p.Pid)
+	return pid
+}
+
+// TID returns the thread ID if p describes a single thread and 0 otherwise.
+func (p *Process) TID() int {
+	tid, _ := strconv.Atoi(p.p.Tid)
+	return tid
+}
+
+// PPID returns the parent process ID.
+func (p *Process) PPID() int {
+	ppid, _ := strconv.Atoi(p.p.Stat.Ppid)
+	return ppid
+}
+
+// Comm returns the command name.
+func (p *Process) Comm() string {
+	return p.p.Stat.Comm
+}
+
+// State returns the state (e.g., "R" or "S").
+func (p *Process) State() string {
+	return p.p.Stat.State
+}
+
+// Args returns the command line arguments.
+func (p *Process) Args() []string {
+	return append([]string(nil), p.p.CmdLine...)
+}
+
+// ReadFile reads the file name (e.g., "cgroup") in /proc/$pid or, for
+// threads, in /proc/$pid/task/$tid.
+func (p *Process) ReadFile(name string) ([]byte, error) {
+	return p.p.ReadFile(name)
+}
+
+// Environ returns the environment in the form "key=value".
+func (p *Process) Environ() ([]string, error) {
+	data, err := p.ReadFile("environ")
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{}
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		if len(kv) > 0 {
+			env = append(env, string(kv))
+		}
+	}
+
+	return env, nil
+}
+
+// Value returns the typed value of the descriptor name (e.g., "user"), which
+// may be a built-in or a registered one.  The files the descriptor depends on
+// are read on demand.
+func (p *Process) Value(name string) (interface{}, error) {
+	descs, err := translateDescriptors([]string{name})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.p.Require(p.ctx.parseCtx, descs[0].sources); err != nil {
+		return nil, err
+	}
+
+	return descs[0].procFn(p.p, p.ctx)
+}
@@ -0,0 +1,326 @@
+package ps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/process"
+	"github.com/scmn-dev/ps/internal/procfs"
+	"golang.org/x/sys/unix"
+)
+
+// File is an open file descriptor of a process as listed by FilesByPids.
+type File struct {
+	// PID is the process ID as passed to FilesByPids and friends.
+	PID int
+	// FD is the number of the file descriptor.
+	FD int
+	// Type is the type of the file similar to lsof, i.e., "REG", "DIR",
+	// "CHR", "BLK", "FIFO", "sock", "a_inode" or "unknown".
+	Type string
+	// Target is the path of the file or a pseudo file such as
+	// "socket:[12345]".
+	Target string
+	// Flags are the names of the flags the file was opened with (e.g.,
+	// "RDWR|CLOEXEC").
+	Flags string
+	// Pos is the file offset.
+	Pos int64
+}
+
+// openFlags are the names of the flags of open(2) listed in File.Flags.
+var openFlags = []struct {
+	flag int
+	name string
+}{
+	{unix.O_APPEND, "APPEND"},
+	{unix.O_ASYNC, "ASYNC"},
+	{unix.O_CLOEXEC, "CLOEXEC"},
+	{unix.O_CREAT, "CREAT"},
+	{unix.O_DIRECT, "DIRECT"},
+	{unix.O_DIRECTORY, "DIRECTORY"},
+	{unix.O_DSYNC, "DSYNC"},
+	{unix.O_EXCL, "EXCL"},
+	{unix.O_NOATIME, "NOATIME"},
+	{unix.O_NOCTTY, "NOCTTY"},
+	{unix.O_NOFOLLOW, "NOFOLLOW"},
+	{unix.O_NONBLOCK, "NONBLOCK"},
+	{unix.O_PATH, "PATH"},
+	{unix.O_SYNC &^ unix.O_DSYNC, "SYNC"},
+	{unix.O_TRUNC, "TRUNC"},
+}
+
+// newFile converts fd of process pid to a File.
+func newFile(pid int, fd proc.FD) File {
+	flags := []string{}
+	switch fd.Flags & unix.O_ACCMODE {
+	case unix.O_RDONLY:
+		flags = append(flags, "RDONLY")
+	case unix.O_WRONLY:
+		flags = append(flags, "WRONLY")
+	case unix.O_RDWR:
+		flags = append(flags, "RDWR")
+	}
+
+	for _, f := range openFlags {
+		if fd.Flags&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+
+	return File{
+		PID:    pid,
+		FD:     fd.Num,
+		Type:   fileType(fd),
+		Target: fd.Target,
+		Flags:  strings.Join(flags, "|"),
+		Pos:    fd.Pos,
+	}
+}
+
+// fileType returns the lsof-like type of fd.
+func fileType(fd proc.FD) string {
+	switch {
+	case strings.HasPrefix(fd.Target, "socket:"):
+		return "sock"
+	case strings.HasPrefix(fd.Target, "pipe:"):
+		return "FIFO"
+	case strings.HasPrefix(fd.Target, "anon_inode:"):
+		return "a_inode"
+	case fd.Mode == 0:
+		return "unknown"
+	case fd.Mode.IsDir():
+		return "DIR"
+	case fd.Mode&os.ModeCharDevice != 0:
+		return "CHR"
+	case fd.Mode&os.ModeDevice != 0:
+		return "BLK"
+	case fd.Mode&os.ModeNamedPipe != 0:
+		return "FIFO"
+	case fd.Mode&os.ModeSocket != 0:
+		return "sock"
+	case fd.Mode.IsRegular():
+		return "REG"
+	default:
+		return "unknown"
+	}
+}
+
+// FilesByPids returns the open file descriptors of the processes with the
+// specified pids or of all processes if pids is empty.  Processes the caller
+// may not trace are skipped.
+func FilesByPids(pids []string, options *ProcessInfoOpts) ([]File, error) {
+	return FilesByPidsContext(context.Background(), pids, options)
+}
+
+// FilesByPidsContext is like FilesByPids but returns the files listed so far
+// along with a *TimeoutError once ctx is done.
+func FilesByPidsContext(ctx context.Context, pids []string, options *ProcessInfoOpts) ([]File, error) {
+	fsys := options.fs()
+
+	if len(pids) == 0 {
+		var err error
+		pids, err = proc.GetPIDs(fsys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := []File{}
+	for _, pid := range pids {
+		if err := ctx.Err(); err != nil {
+			return files, &TimeoutError{Err: err}
+		}
+
+		pidFiles, err := filesOf(fsys, pid, pid)
+		if err != nil {
+			// skip processes that exited meanwhile or that the caller
+			// may not trace like lsof
+			if os.IsNotExist(errors.Cause(err)) || os.IsPermission(errors.Cause(err)) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		files = append(files, pidFiles...)
+	}
+
+	return files, nil
+}
+
+// JoinNamespaceAndFilesByPids returns the open file descriptors of the
+// processes with the specified pids with their paths resolved in the mount
+// namespace of each process (e.g., of a container).
+func JoinNamespaceAndFilesByPids(pids []string, options *JoinNamespaceOpts) ([]File, error) {
+	return JoinNamespaceAndFilesByPidsContext(context.Background(), pids, options)
+}
+
+// JoinNamespaceAndFilesByPidsContext is like JoinNamespaceAndFilesByPids but
+// returns the files listed so far along with a *TimeoutError once ctx is
+// done.
+func JoinNamespaceAndFilesByPidsContext(ctx context.Context, pids []string, options *JoinNamespaceOpts) ([]File, error) {
+	var opts *ProcessInfoOpts
+	if options != nil {
+		opts = &options.ProcessInfoOpts
+	}
+
+	// joining the mount namespace needs a file descriptor and thus a live
+	// /proc
+	root, ok := opts.fs().(procfs.Root)
+	if !ok {
+		return nil, errors.New("cannot join the namespaces of archived processes")
+	}
+
+	files := []File{}
+	for _, pid := range pids {
+		if err := ctx.Err(); err != nil {
+			return files, &TimeoutError{Err: err}
+		}
+
+		pidFiles, err := joinNamespaceAndFiles(ctx, root, pid)
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return files, &TimeoutError{Err: ctx.Err()}
+			}
+
+			return nil, err
+		}
+
+		files = append(files, pidFiles...)
+	}
+
+	return files, nil
+}
+
+// joinNamespaceAndFiles joins the mount namespace of pid and returns its
+// open file descriptors.
+func joinNamespaceAndFiles(ctx context.Context, root procfs.Root, pid string) ([]File, error) {
+	// the process is found by its ID in the pid namespace of the /proc
+	// mounted in its mount namespace
+	status, err := proc.ParseStatus(ctx, root, pid, false)
+	if err != nil {
+		return nil, err
+	}
+
+	nsPid := pid
+	if len(status.NSpid) > 0 {
+		nsPid = status.NSpid[len(status.NSpid)-1]
+	}
+
+	// the thread is left in the joined mount namespace, so it's never
+	// unlocked and thus never reused
+	var (
+		files []File
+		wg    sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runtime.LockOSThread()
+		files, err = joinedFiles(root, pid, nsPid)
+	}()
+	wg.Wait()
+
+	return files, err
+}
+
+// joinedFiles joins the mount namespace of pid, which is nsPid in it, and
+// returns its open file descriptors.  It must be called on a locked thread.
+func joinedFiles(root procfs.Root, pid, nsPid string) ([]File, error) {
+	fd, err := os.Open(root.Path(fmt.Sprintf("/proc/%s/ns/mnt", pid)))
+	if err != nil {
+		return nil, err
+	}
+
+	defer fd.Close()
+
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		return nil, err
+	}
+
+	if err := unix.Setns(int(fd.Fd()), unix.CLONE_NEWNS); err != nil {
+		return nil, err
+	}
+
+	return filesOf(procfs.Host, nsPid, pid)
+}
+
+// filesOf returns the open file descriptors of process pid in fsys, which
+// are reported as those of process id.
+func filesOf(fsys procfs.FS, pid, id string) ([]File, error) {
+	fds, err := proc.ParseFDs(fsys, pid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing files of PID %s", id)
+	}
+
+	idNum, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []File{}
+	for _, fd := range fds {
+		files = append(files, newFile(idNum, fd))
+	}
+
+	return files, nil
+}
+
+// processNFD returns the number of open file descriptors of process p.
+func processNFD(p *process.Process, ctx *psContext) (interface{}, error) {
+	if p.NFD < 0 {
+		return nil, nil
+	}
+
+	return p.NFD, nil
+}
+
+// processFDLIMIT returns the soft limit of open file descriptors of process
+// p or Unlimited.
+func processFDLIMIT(p *process.Process, ctx *psContext) (interface{}, error) {
+	limit, ok := p.Limits["Max open files"]
+	if !ok {
+		return nil, nil
+	}
+
+	if limit.Soft == proc.Unlimited {
+		return Unlimited, nil
+	}
+
+	return limit.Soft, nil
+}
+
+// processPFD returns how many percent of its soft limit of open file
+// descriptors process p uses.  Without permission to count its file
+// descriptors, the size of its file descriptor table is used, which is an
+// upper bound of the highest open file descriptor.
+func processPFD(p *process.Process, ctx *psContext) (interface{}, error) {
+	limit, ok := p.Limits["Max open files"]
+	if !ok || limit.Soft == proc.Unlimited || limit.Soft == 0 {
+		return nil, nil
+	}
+
+	nfd := p.NFD
+	if nfd < 0 {
+		fdSize, err := strconv.Atoi(p.Status.FdSize)
+		if err != nil {
+			return nil, nil
+		}
+		nfd = fdSize
+	}
+
+	return 100 * float64(nfd) / float64(limit.Soft), nil
+}
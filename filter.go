@@ -0,0 +1,630 @@
+package ps
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidFilter is returned when a filter expression cannot be parsed.
+	ErrInvalidFilter = errors.New("invalid filter")
+
+	// ErrFilterTypeMismatch is returned when a filter compares a descriptor
+	// with a literal of an incompatible type (e.g., `rss > root`).
+	ErrFilterTypeMismatch = errors.New("filter type mismatch")
+)
+
+// Filter is a parsed filter expression selecting processes by the values of
+// their descriptors.  A filter expression consists of comparisons which can
+// be combined with `&&`, `||` and `!` and grouped with parentheses:
+//
+//	user == "root" && rss > 100MiB && state in (D, Z) && args ~ "java"
+//
+// The left-hand side of a comparison is a descriptor and the right-hand side
+// a literal, either a double-quoted string or a bare word.  Supported
+// operators are `==`, `!=`, `<`, `<=`, `>`, `>=`, `~` and `!~` (regular
+// expression match against the rendered value), as well as `in (...)` and
+// `not in (...)`.
+//
+// Literals are interpreted depending on the type of the descriptor: numbers
+// for numeric descriptors, where memory sizes (in bytes) accept the suffixes
+// B, K, KB, KiB, M, MB, MiB, G, GB, GiB, T, TB and TiB; Go durations (e.g.,
+// "1h30m") or seconds for durations; RFC 3339 timestamps or dates (e.g.,
+// "2021-10-01") for times; and strings for everything else.  Literals that
+// don't match the type of the descriptor are rejected when parsing.
+// Unavailable values (see Row) match neither comparisons nor `in (...)` and
+// `not in (...)`.
+type Filter struct {
+	spec  string
+	expr  filterNode
+	descs []aixFormatDescriptor
+}
+
+// ParseFilter parses the filter expression spec.
+func ParseFilter(spec string) (*Filter, error) {
+	tokens, err := lexFilter(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	p := filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+
+	return &Filter{spec: spec, expr: expr, descs: p.descs}, nil
+}
+
+// String returns the filter expression f was parsed from.
+func (f *Filter) String() string {
+	return f.spec
+}
+
+// Descriptors returns the names of all descriptors referenced by f.
+func (f *Filter) Descriptors() []string {
+	names := []string{}
+	for _, d := range f.descs {
+		names = append(names, d.normal)
+	}
+
+	return names
+}
+
+// Match evaluates f on row, which must contain the values of all descriptors
+// returned by Descriptors.
+func (f *Filter) Match(row Row) (bool, error) {
+	return f.matchAt(row, time.Now())
+}
+
+// matchAt is like Match for a row listed at now, relative to which times
+// such as "stime" are rendered.
+func (f *Filter) matchAt(row Row, now time.Time) (bool, error) {
+	return f.expr.eval(row, now)
+}
+
+type filterNode interface {
+	eval(row Row, now time.Time) (bool, error)
+}
+
+type andNode struct {
+	left, right filterNode
+}
+
+func (n *andNode) eval(row Row, now time.Time) (bool, error) {
+	ok, err := n.left.eval(row, now)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return n.right.eval(row, now)
+}
+
+type orNode struct {
+	left, right filterNode
+}
+
+func (n *orNode) eval(row Row, now time.Time) (bool, error) {
+	ok, err := n.left.eval(row, now)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	return n.right.eval(row, now)
+}
+
+type notNode struct {
+	node filterNode
+}
+
+func (n *notNode) eval(row Row, now time.Time) (bool, error) {
+	ok, err := n.node.eval(row, now)
+	return !ok, err
+}
+
+// cmpNode compares the value of a descriptor with one or more literals.
+type cmpNode struct {
+	desc     aixFormatDescriptor
+	op       string
+	literals []string
+	re       *regexp.Regexp
+}
+
+func (n *cmpNode) eval(row Row, now time.Time) (bool, error) {
+	value := row[n.desc.normal]
+
+	switch n.op {
+	case "~":
+		return n.re.MatchString(n.desc.renderIn(value, UnitKiB, now)), nil
+	case "!~":
+		return !n.re.MatchString(n.desc.renderIn(value, UnitKiB, now)), nil
+	case "in", "not in":
+		if value == nil {
+			return false, nil
+		}
+		found := false
+		for _, lit := range n.literals {
+			c, err := n.compare(value, lit, now)
+			if err != nil {
+				return false, err
+			}
+			if c == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in"), nil
+	}
+
+	if value == nil {
+		return false, nil
+	}
+
+	c, err := n.compare(value, n.literals[0], now)
+	if err != nil {
+		return false, err
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+
+	return false, errors.Wrapf(ErrInvalidFilter, "unknown operator %q", n.op)
+}
+
+// compare compares the available value with the literal lit interpreted
+// according to the type of value.
+func (n *cmpNode) compare(value interface{}, lit string, now time.Time) (int, error) {
+	kind := kindOther
+	switch value.(type) {
+	case int, int64, uint64, float64:
+		kind = kindNumber
+	case time.Duration:
+		kind = kindDuration
+	case time.Time:
+		kind = kindTime
+	}
+
+	if kind == kindOther {
+		// strings and the like compare by their rendering
+		return strings.Compare(n.desc.renderIn(value, UnitKiB, now), lit), nil
+	}
+
+	other, err := parseLiteralAs(kind, lit)
+	if err != nil {
+		return 0, errors.Wrapf(ErrFilterTypeMismatch, "cannot compare %s (%s) with %q", n.desc.normal, kind, lit)
+	}
+
+	// limits that aren't set are Unlimited (see Row)
+	if _, ok := value.(uint64); ok && other == math.Inf(1) {
+		other = Unlimited
+	}
+
+	return compareValues(value, other), nil
+}
+
+// String returns the name of k used in error messages.
+func (k valueKind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindDuration:
+		return "duration"
+	case kindTime:
+		return "time"
+	}
+
+	return "string"
+}
+
+// parseLiteralAs parses the literal lit as a value of kind, which must not
+// be kindOther.
+func parseLiteralAs(kind valueKind, lit string) (interface{}, error) {
+	switch kind {
+	case kindNumber:
+		if lit == "max" || lit == "unlimited" {
+			return math.Inf(1), nil
+		}
+		return parseSizeLiteral(lit)
+	case kindDuration:
+		return parseDurationLiteral(lit)
+	case kindTime:
+		return parseTimeLiteral(lit)
+	}
+
+	return nil, fmt.Errorf("cannot parse %q as %s", lit, kind)
+}
+
+// sizeUnits maps the supported suffixes of numeric literals to multipliers.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// parseSizeLiteral parses a number with an optional size suffix.
+func parseSizeLiteral(lit string) (float64, error) {
+	i := strings.IndexFunc(lit, func(r rune) bool {
+		return unicode.IsLetter(r)
+	})
+	if i == -1 {
+		i = len(lit)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(lit[i:])]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %q", lit)
+	}
+
+	num, err := strconv.ParseFloat(lit[:i], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return num * unit, nil
+}
+
+// parseDurationLiteral parses a Go duration or a number of seconds.
+func parseDurationLiteral(lit string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(lit, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+
+	return time.ParseDuration(lit)
+}
+
+// timeLayouts are the layouts accepted for time literals.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimeLiteral parses an RFC 3339 timestamp or a local date and time.
+func parseTimeLiteral(lit string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, lit, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("cannot parse %q as time", lit)
+}
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokWord
+	tokString
+	tokOp
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+// filterOps are the operators of the filter language, longest first.
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!", "(", ")", ","}
+
+// isWordChar returns true if r may be part of a bare word.
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.%/:-+@", r)
+}
+
+func lexFilter(spec string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	runes := []rune(spec)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, errors.Wrapf(ErrInvalidFilter, "unterminated string at position %d", i+1)
+			}
+			text, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, errors.Wrapf(ErrInvalidFilter, "invalid string at position %d", i+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokString, text: text, pos: i + 1})
+			i = j + 1
+		case isWordChar(r):
+			j := i
+			for j < len(runes) && isWordChar(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokWord, text: string(runes[i:j]), pos: i + 1})
+			i = j
+		default:
+			found := false
+			for _, op := range filterOps {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, filterToken{kind: tokOp, text: op, pos: i + 1})
+					i += len([]rune(op))
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Wrapf(ErrInvalidFilter, "unexpected %q at position %d", r, i+1)
+			}
+		}
+	}
+
+	return append(tokens, filterToken{kind: tokEOF, pos: len(runes) + 1}), nil
+}
+
+// filterParser is a recursive-descent parser for filter expressions.
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	descs  []aixFormatDescriptor
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) isOp(op string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && tok.text == op
+}
+
+func (p *filterParser) isWord(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokWord && tok.text == word
+}
+
+func (p *filterParser) errorf(tok filterToken, format string, args ...interface{}) error {
+	if tok.kind == tokEOF {
+		return errors.Wrapf(ErrInvalidFilter, "%s at end of expression", fmt.Sprintf(format, args...))
+	}
+
+	return errors.Wrapf(ErrInvalidFilter, "%s at position %d", fmt.Sprintf(format, args...), tok.pos)
+}
+
+func (p *filterParser) expectOp(op string) error {
+	if tok := p.next(); tok.kind != tokOp || tok.text != op {
+		return p.errorf(tok, "expected %q", op)
+	}
+
+	return nil
+}
+
+// parseOr parses `and ("||" and)*`.
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseAnd parses `unary ("&&" unary)*`.
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseUnary parses `"!" unary | "(" or ")" | comparison`.
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch {
+	case p.isOp("!"):
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node: node}, nil
+	case p.isOp("("):
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+// parseComparison parses `descriptor op literal` and
+// `descriptor ["not"] "in" "(" literal ("," literal)* ")"`.
+func (p *filterParser) parseComparison() (filterNode, error) {
+	tok := p.next()
+	if tok.kind != tokWord {
+		return nil, p.errorf(tok, "expected descriptor")
+	}
+
+	descs, err := translateDescriptors([]string{tok.text})
+	if err != nil {
+		return nil, err
+	}
+	node := &cmpNode{desc: descs[0]}
+	p.addDescriptor(node.desc)
+
+	switch {
+	case p.isWord("in"):
+		p.next()
+		node.op = "in"
+	case p.isWord("not"):
+		p.next()
+		if !p.isWord("in") {
+			return nil, p.errorf(p.peek(), "expected \"in\"")
+		}
+		p.next()
+		node.op = "not in"
+	default:
+		op := p.next()
+		switch op.text {
+		case "==", "!=", "<", "<=", ">", ">=", "~", "!~":
+			if op.kind != tokOp {
+				return nil, p.errorf(op, "expected operator")
+			}
+			node.op = op.text
+		default:
+			return nil, p.errorf(op, "expected operator")
+		}
+	}
+
+	if node.op == "in" || node.op == "not in" {
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		for {
+			lit, err := p.parseTypedLiteral(node.desc)
+			if err != nil {
+				return nil, err
+			}
+			node.literals = append(node.literals, lit)
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	if node.op == "~" || node.op == "!~" {
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		node.literals = []string{lit}
+		node.re, err = regexp.Compile(lit)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidFilter, "invalid regular expression %q: %v", lit, err)
+		}
+		return node, nil
+	}
+
+	lit, err := p.parseTypedLiteral(node.desc)
+	if err != nil {
+		return nil, err
+	}
+	node.literals = []string{lit}
+
+	return node, nil
+}
+
+// parseLiteral parses a string or a bare word.
+func (p *filterParser) parseLiteral() (string, error) {
+	tok := p.next()
+	if tok.kind != tokString && tok.kind != tokWord {
+		return "", p.errorf(tok, "expected literal")
+	}
+
+	return tok.text, nil
+}
+
+// parseTypedLiteral parses a literal and checks that it can be compared with
+// the values of d.
+func (p *filterParser) parseTypedLiteral(d aixFormatDescriptor) (string, error) {
+	tok := p.peek()
+	lit, err := p.parseLiteral()
+	if err != nil {
+		return "", err
+	}
+
+	if kind := d.valueKind(); kind != kindOther {
+		if _, err := parseLiteralAs(kind, lit); err != nil {
+			return "", errors.Wrapf(ErrFilterTypeMismatch, "cannot compare %s (%s) with %q at position %d", d.normal, kind, lit, tok.pos)
+		}
+	}
+
+	return lit, nil
+}
+
+// addDescriptor records d as referenced by the filter.
+func (p *filterParser) addDescriptor(d aixFormatDescriptor) {
+	for _, desc := range p.descs {
+		if desc.normal == d.normal {
+			return
+		}
+	}
+
+	p.descs = append(p.descs, d)
+}
@@ -0,0 +1,120 @@
+package ps
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  error
+	}{
+		{`rss > abc`, ErrFilterTypeMismatch},
+		{`etime < soon`, ErrFilterTypeMismatch},
+		{`stime > yesterday`, ErrFilterTypeMismatch},
+		{`pid in (1, two)`, ErrFilterTypeMismatch},
+		{`pid ==`, ErrInvalidFilter},
+		{`pid 1`, ErrInvalidFilter},
+		{`(pid == 1`, ErrInvalidFilter},
+		{`user == "root`, ErrInvalidFilter},
+		{`args ~ "("`, ErrInvalidFilter},
+		{`pid == 1 pid`, ErrInvalidFilter},
+		{`nosuchdescriptor == 1`, ErrUnknownDescriptor},
+	}
+
+	for _, test := range tests {
+		_, err := ParseFilter(test.spec)
+		if errors.Cause(err) != test.err {
+			t.Errorf("%s: got error %v, want %v", test.spec, err, test.err)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.Local)
+	row := Row{
+		"user":       "root",
+		"pid":        42,
+		"rss":        uint64(200 << 20),
+		"pcpu":       12.5,
+		"etime":      90 * time.Minute,
+		"stime":      now.Add(-90 * time.Minute),
+		"state":      "S",
+		"args":       "java -jar app.jar",
+		"memory_max": Unlimited,
+		"hpid":       nil,
+	}
+
+	tests := []struct {
+		spec  string
+		match bool
+	}{
+		{`user == "root"`, true},
+		{`user != root`, false},
+		{`pid == 42`, true},
+		{`pid >= 43`, false},
+		{`rss > 100MiB`, true},
+		{`rss <= 200M`, true},
+		{`rss < 1GB`, true},
+		{`pcpu > 12`, true},
+		{`etime > 1h`, true},
+		{`etime < 3600`, false},
+		{`stime >= 2021-10-01`, true},
+		{`stime > "2021-10-01 11:00"`, false},
+		{`state in (D, S, Z)`, true},
+		{`state not in (D, S, Z)`, false},
+		{`args ~ "^java"`, true},
+		{`args !~ java`, false},
+		{`memory_max == max`, true},
+		{`memory_max > 1TiB`, true},
+		{`user == root && rss > 100MiB`, true},
+		{`user != root || pid == 42`, true},
+		{`!(pid == 42)`, false},
+		{`!pid == 1 && (state == D || state == S)`, true},
+		// unavailable values match neither comparisons nor lists
+		{`hpid == 1`, false},
+		{`hpid != 1`, false},
+		{`hpid < 1`, false},
+		{`hpid in (1, 2)`, false},
+		{`hpid not in (1, 2)`, false},
+		{`!(hpid == 1)`, true},
+	}
+
+	for _, test := range tests {
+		f, err := ParseFilter(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+
+		match, err := f.matchAt(row, now)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		if match != test.match {
+			t.Errorf("%s: got %v, want %v", test.spec, match, test.match)
+		}
+	}
+}
+
+func TestFilterDescriptors(t *testing.T) {
+	f, err := ParseFilter(`user == root && (rss > 1M || user != nobody) && %p > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := f.Descriptors()
+	want := []string{"user", "rss", "pid"}
+	if len(got) != len(want) {
+		t.Fatalf("got descriptors %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got descriptors %v, want %v", got, want)
+		}
+	}
+}
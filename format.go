@@ -0,0 +1,349 @@
+package ps
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidFormat is returned when parsing a malformed format string.
+var ErrInvalidFormat = errors.New("invalid format")
+
+// columnGap separates the columns of keyword lists.
+const columnGap = "   "
+
+// Format is a parsed format string, which is either a list of descriptors
+// separated by commas or spaces or an AIX format string.
+//
+// Each descriptor in a list may be followed by a width (e.g., "pid:8") and a
+// header overriding the default one (e.g., "pid=MYPID" or "pid:8=MYPID").
+// As with `ps -o`, the header extends to the end of the spec, so it may
+// contain commas and spaces (e.g., "pid,comm=COMMAND NAME").  An empty
+// header (e.g., "pid=") leaves the column's header blank, and the header
+// line is omitted if all headers are blank.
+//
+// AIX format strings embed AIX codes in literal text (e.g., "%p %U: %a"),
+// and any spec using an AIX code is parsed as one, so "%p,%U" renders
+// "1,root" rather than two columns.  They render to lines following the
+// exact template with "%%" standing for a literal "%".
+type Format struct {
+	columns []formatColumn
+	// trailer is the literal text after the last column.
+	trailer string
+	// unit is the unit memory descriptors are rendered in.
+	unit Unit
+	// noHeader omits the header line.
+	noHeader bool
+	// now is the time of the listing or zero for the current time.
+	now time.Time
+}
+
+// formatColumn is a single descriptor of a Format.
+type formatColumn struct {
+	// prefix is the literal text preceding the column.
+	prefix string
+	desc   aixFormatDescriptor
+	// width is the width of the column or 0 to fit the widest value.
+	width int
+}
+
+// ParseFormat parses specs into a Format, which renders the columns of all
+// specs in order like several `ps -o` options.
+func ParseFormat(specs ...string) (*Format, error) {
+	if len(specs) == 0 {
+		return nil, errors.Wrap(ErrInvalidFormat, "no descriptors")
+	}
+
+	descriptorsMu.RLock()
+	defer descriptorsMu.RUnlock()
+
+	f := &Format{}
+	for i, spec := range specs {
+		next, err := parseFormat(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			next.columns[0].prefix = f.trailer + columnGap + next.columns[0].prefix
+		}
+		f.columns = append(f.columns, next.columns...)
+		f.trailer = next.trailer
+	}
+
+	return f, nil
+}
+
+// Descriptors returns the names of the descriptors of f in order, which can
+// be passed to ProcessRows and friends.
+func (f *Format) Descriptors() []string {
+	names := []string{}
+	for _, c := range f.columns {
+		names = append(names, c.desc.normal)
+	}
+
+	return names
+}
+
+// SetUnit sets the unit the values of memory descriptors (e.g., "rss") are
+// rendered in, which defaults to UnitKiB.
+func (f *Format) SetUnit(unit Unit) {
+	f.unit = unit
+}
+
+// SetTime sets the time of the listing, relative to which times such as
+// "stime" are rendered.  It defaults to the current time and must be set to
+// the Time of the Archive for captured processes.
+func (f *Format) SetTime(now time.Time) {
+	f.now = now
+}
+
+// SetHeader sets whether Render precedes the rows by a header line, which
+// it does by default unless all headers are blank.
+func (f *Format) SetHeader(header bool) {
+	f.noHeader = !header
+}
+
+// Render renders rows as lines according to f, preceded by a header line
+// unless all headers are blank.  Columns without a width are padded to
+// their widest value.
+func (f *Format) Render(rows []Row) []string {
+	header := false
+	for _, c := range f.columns {
+		if c.desc.header != "" && !f.noHeader {
+			header = true
+		}
+	}
+
+	table := [][]string{}
+	if header {
+		cells := []string{}
+		for _, c := range f.columns {
+			cells = append(cells, c.desc.header)
+		}
+		table = append(table, cells)
+	}
+
+	now := f.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	for _, row := range rows {
+		cells := []string{}
+		for _, c := range f.columns {
+			cells = append(cells, c.desc.renderIn(row[c.desc.normal], f.unit, now))
+		}
+		table = append(table, cells)
+	}
+
+	widths := make([]int, len(f.columns))
+	for i, c := range f.columns {
+		widths[i] = c.width
+		if c.width > 0 {
+			continue
+		}
+		for _, cells := range table {
+			if n := utf8.RuneCountInString(cells[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	lines := []string{}
+	for _, cells := range table {
+		var b strings.Builder
+		for i, c := range f.columns {
+			b.WriteString(c.prefix)
+			b.WriteString(cells[i])
+			// don't pad the last column
+			if i < len(f.columns)-1 || f.trailer != "" {
+				if pad := widths[i] - utf8.RuneCountInString(cells[i]); pad > 0 {
+					b.WriteString(strings.Repeat(" ", pad))
+				}
+			}
+		}
+		line := b.String()
+		if f.trailer == "" {
+			// drop the padding before blank trailing cells
+			line = strings.TrimRight(line, " ")
+		}
+		lines = append(lines, line+f.trailer)
+	}
+
+	return lines
+}
+
+// parseFormat parses spec into a Format.  The caller must hold
+// descriptorsMu.
+func parseFormat(spec string) (*Format, error) {
+	if hasAIXCode(spec) {
+		return parseAIXFormat(spec)
+	}
+
+	f, err := parseKeywordList(spec)
+	if err == nil {
+		return f, nil
+	}
+
+	// AIX codes may follow literal text (e.g., "PID=%p")
+	if strings.Contains(spec, "%") {
+		return parseAIXFormat(spec)
+	}
+
+	return nil, err
+}
+
+// hasAIXCode returns true if a descriptor name in spec contains a "%" but
+// isn't a procps-ng keyword such as "%cpu", in which case spec is an AIX
+// format string (e.g., "%p %a" or "%p,%U").  The caller must hold
+// descriptorsMu.
+func hasAIXCode(spec string) bool {
+	// headers may contain a "%" (e.g., "pcpu=%CPU")
+	if j := strings.Index(spec, "="); j >= 0 {
+		spec = spec[:j]
+	}
+
+	for _, name := range splitKeywords(spec) {
+		if j := strings.LastIndex(name, ":"); j >= 0 {
+			name = name[:j]
+		}
+		if !strings.Contains(name, "%") {
+			continue
+		}
+
+		desc, ok := lookupDescriptor(name)
+		if !ok || desc.code == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseKeywordList parses a list of descriptors of the form
+// "name[:width][=header]" separated by commas or spaces.  The header of a
+// descriptor extends to the end of spec, so no descriptor may follow it.
+func parseKeywordList(spec string) (*Format, error) {
+	header, hasHeader := "", false
+	if j := strings.Index(spec, "="); j >= 0 {
+		spec, header, hasHeader = spec[:j], spec[j+1:], true
+	}
+
+	keywords := splitKeywords(spec)
+	if len(keywords) == 0 {
+		return nil, errors.Wrap(ErrInvalidFormat, "no descriptors")
+	}
+	// the header belongs to the descriptor right before the "="
+	if hasHeader && strings.TrimRightFunc(spec, isKeywordSeparator) != spec {
+		return nil, errors.Wrapf(ErrInvalidFormat, "header '%s' without descriptor", header)
+	}
+
+	f := &Format{}
+	for i, keyword := range keywords {
+		name := keyword
+
+		width := 0
+		if j := strings.LastIndex(name, ":"); j >= 0 {
+			w, err := strconv.Atoi(name[j+1:])
+			if err != nil || w < 1 {
+				return nil, errors.Wrapf(ErrInvalidFormat, "invalid width in '%s'", keyword)
+			}
+			name, width = name[:j], w
+		}
+
+		desc, ok := lookupDescriptor(name)
+		if !ok {
+			return nil, errors.Wrapf(ErrUnknownDescriptor, "'%s'", name)
+		}
+		if hasHeader && i == len(keywords)-1 {
+			desc.header = header
+		}
+
+		c := formatColumn{desc: desc, width: width}
+		if i > 0 {
+			c.prefix = columnGap
+		}
+		f.columns = append(f.columns, c)
+	}
+
+	return f, nil
+}
+
+// splitKeywords splits spec at commas and spaces.
+func splitKeywords(spec string) []string {
+	return strings.FieldsFunc(spec, isKeywordSeparator)
+}
+
+// isKeywordSeparator returns true if r separates the descriptors of keyword
+// lists.
+func isKeywordSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// parseAIXFormat parses an AIX format string with codes embedded in literal
+// text.  The longest code matching at a "%" is used.
+func parseAIXFormat(spec string) (*Format, error) {
+	f := &Format{}
+	var literal strings.Builder
+	for i := 0; i < len(spec); {
+		if spec[i] != '%' {
+			literal.WriteByte(spec[i])
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(spec[i:], "%%") {
+			literal.WriteByte('%')
+			i += 2
+			continue
+		}
+
+		var desc *aixFormatDescriptor
+		for j := range aixFormatDescriptors {
+			code := aixFormatDescriptors[j].code
+			if code == "" || !strings.HasPrefix(spec[i:], code) {
+				continue
+			}
+			if desc == nil || len(code) > len(desc.code) {
+				desc = &aixFormatDescriptors[j]
+			}
+		}
+
+		if desc == nil {
+			end := i + 1
+			if end < len(spec) {
+				_, n := utf8.DecodeRuneInString(spec[end:])
+				end += n
+			}
+			return nil, errors.Wrapf(ErrUnknownDescriptor, "'%s'", spec[i:end])
+		}
+
+		f.columns = append(f.columns, formatColumn{prefix: literal.String(), desc: *desc})
+		literal.Reset()
+		i += len(desc.code)
+	}
+
+	if len(f.columns) == 0 {
+		return nil, errors.Wrap(ErrInvalidFormat, "no descriptors")
+	}
+	f.trailer = literal.String()
+
+	return f, nil
+}
+
+// lookupDescriptor returns the descriptor with the specified name, AIX code
+// or procps-ng keyword.  The caller must hold descriptorsMu.
+func lookupDescriptor(name string) (aixFormatDescriptor, bool) {
+	for _, aix := range aixFormatDescriptors {
+		if name == aix.normal || (aix.code != "" && name == aix.code) {
+			return aix, true
+		}
+	}
+
+	return lookupAlias(name)
+}
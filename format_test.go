@@ -0,0 +1,127 @@
+package ps
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// formatRows are the rows rendered by the format tests.
+var formatRows = []Row{
+	{"pid": 1, "user": "root", "comm": "init", "rss": uint64(10 << 20), "memory_max": Unlimited, "etime": 90 * time.Minute, "hpid": nil},
+	{"pid": 1234, "user": "nobody", "comm": "sleep", "rss": uint64(512 << 10), "memory_max": uint64(1 << 30), "etime": 5 * time.Second, "hpid": 42},
+}
+
+func TestFormatRender(t *testing.T) {
+	tests := []struct {
+		specs       []string
+		descriptors []string
+		lines       []string
+	}{
+		{
+			[]string{"pid,user,comm"},
+			[]string{"pid", "user", "comm"},
+			[]string{"PID    USER     COMMAND", "1      root     init", "1234   nobody   sleep"},
+		},
+		{
+			[]string{"pid user comm"},
+			[]string{"pid", "user", "comm"},
+			[]string{"PID    USER     COMMAND", "1      root     init", "1234   nobody   sleep"},
+		},
+		{
+			// widths are fixed and headers extend to the end of the spec
+			[]string{"pid:8,comm=COMMAND NAME"},
+			[]string{"pid", "comm"},
+			[]string{"PID        COMMAND NAME", "1          init", "1234       sleep"},
+		},
+		{
+			// blank headers omit the header line
+			[]string{"pid=", "comm="},
+			[]string{"pid", "comm"},
+			[]string{"1      init", "1234   sleep"},
+		},
+		{
+			[]string{"pid", "rss,memory_max"},
+			[]string{"pid", "rss", "memory_max"},
+			[]string{"PID    RSS     MEMMAX", "1      10240   max", "1234   512     1048576"},
+		},
+		{
+			[]string{"pid,etime,hpid"},
+			[]string{"pid", "etime", "hpid"},
+			[]string{"PID    ELAPSED    HPID", "1      01:30:00   ?", "1234   00:05      42"},
+		},
+		{
+			[]string{"%p %U: %c"},
+			[]string{"pid", "user", "comm"},
+			[]string{"PID  USER  : COMMAND", "1    root  : init", "1234 nobody: sleep"},
+		},
+		{
+			[]string{"%p,%U"},
+			[]string{"pid", "user"},
+			[]string{"PID ,USER", "1   ,root", "1234,nobody"},
+		},
+		{
+			[]string{"PID=%p"},
+			[]string{"pid"},
+			[]string{"PID=PID", "PID=1", "PID=1234"},
+		},
+		{
+			[]string{"100%% %p"},
+			[]string{"pid"},
+			[]string{"100% PID", "100% 1", "100% 1234"},
+		},
+	}
+
+	for _, test := range tests {
+		f, err := ParseFormat(test.specs...)
+		if err != nil {
+			t.Errorf("%q: %v", test.specs, err)
+			continue
+		}
+
+		if got := f.Descriptors(); !reflect.DeepEqual(got, test.descriptors) {
+			t.Errorf("%q: got descriptors %q, want %q", test.specs, got, test.descriptors)
+		}
+		if got := f.Render(formatRows); !reflect.DeepEqual(got, test.lines) {
+			t.Errorf("%q: got lines %q, want %q", test.specs, got, test.lines)
+		}
+	}
+}
+
+func TestFormatSettings(t *testing.T) {
+	f, err := ParseFormat("pid,rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.SetUnit(UnitMiB)
+	f.SetHeader(false)
+
+	want := []string{"1      10", "1234   0"}
+	if got := f.Render(formatRows); !reflect.DeepEqual(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+}
+
+func TestParseFormatErrors(t *testing.T) {
+	tests := []struct {
+		specs []string
+		err   error
+	}{
+		{nil, ErrInvalidFormat},
+		{[]string{""}, ErrInvalidFormat},
+		{[]string{"pid:x"}, ErrInvalidFormat},
+		{[]string{"pid:-1"}, ErrInvalidFormat},
+		{[]string{"nosuch"}, ErrUnknownDescriptor},
+		{[]string{"%Z"}, ErrUnknownDescriptor},
+	}
+
+	for _, test := range tests {
+		_, err := ParseFormat(test.specs...)
+		if errors.Cause(err) != test.err {
+			t.Errorf("%q: got error %v, want %v", test.specs, err, test.err)
+		}
+	}
+}
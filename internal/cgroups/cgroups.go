@@ -1,31 +1,41 @@
 package cgroups
 
 import (
+	"os"
+	"path/filepath"
 	"sync"
-	"syscall"
+
+	"github.com/scmn-dev/ps/internal/procfs"
 )
 
 const (
-	CgroupRoot        = "/sys/fs/cgroup"
-	cgroup2SuperMagic = 0x63677270
+	CgroupRoot = "/sys/fs/cgroup"
 )
 
 var (
-	isUnifiedOnce sync.Once
-	isUnified     bool
-	isUnifiedErr  error
+	isUnifiedMu sync.Mutex
+	// isUnified caches the mode of each procfs.FS.
+	isUnified = make(map[procfs.FS]bool)
 )
 
 // IsCgroup2UnifiedMode returns whether we are running in cgroup or cgroupv2 mode.
-func IsCgroup2UnifiedMode() (bool, error) {
-	isUnifiedOnce.Do(func() {
-		var st syscall.Statfs_t
-		if err := syscall.Statfs(CgroupRoot, &st); err != nil {
-			isUnified, isUnifiedErr = false, err
-		} else {
-			isUnified, isUnifiedErr = st.Type == cgroup2SuperMagic, nil
+// Only cgroup2 has a cgroup.controllers file in its root.
+func IsCgroup2UnifiedMode(fsys procfs.FS) (bool, error) {
+	isUnifiedMu.Lock()
+	defer isUnifiedMu.Unlock()
+
+	if unified, ok := isUnified[fsys]; ok {
+		return unified, nil
+	}
+
+	unified := true
+	if _, err := fsys.Stat(filepath.Join(CgroupRoot, "cgroup.controllers")); err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
 		}
-	})
+		unified = false
+	}
 
-	return isUnified, isUnifiedErr
+	isUnified[fsys] = unified
+	return unified, nil
 }
@@ -3,7 +3,8 @@ package dev
 import (
 	"os"
 	"strings"
-	"syscall"
+
+	"github.com/scmn-dev/ps/internal/procfs"
 )
 
 type TTY struct {
@@ -12,16 +13,9 @@ type TTY struct {
 	Path string
 }
 
-func TTYs() (*[]TTY, error) {
-	devDir, err := os.Open("/dev/")
-	if err != nil {
-		return nil, err
-	}
-
-	defer devDir.Close()
-
+func TTYs(fsys procfs.FS) (*[]TTY, error) {
 	devices := []string{}
-	devTTYs, err := devDir.Readdirnames(0)
+	devTTYs, err := fsys.ReadDirNames("/dev")
 	if err != nil {
 		return nil, err
 	}
@@ -33,14 +27,7 @@ func TTYs() (*[]TTY, error) {
 		devices = append(devices, "/dev/"+d)
 	}
 
-	devPTSDir, err := os.Open("/dev/pts/")
-	if err != nil {
-		return nil, err
-	}
-
-	defer devPTSDir.Close()
-
-	devPTSs, err := devPTSDir.Readdirnames(0)
+	devPTSs, err := fsys.ReadDirNames("/dev/pts")
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +38,7 @@ func TTYs() (*[]TTY, error) {
 
 	ttys := []TTY{}
 	for _, dev := range devices {
-		fi, err := os.Stat(dev)
+		fi, err := fsys.Stat(dev)
 		if err != nil {
 			if os.IsNotExist(err) {
 				continue
@@ -60,11 +47,14 @@ func TTYs() (*[]TTY, error) {
 			return nil, err
 		}
 
-		s := fi.Sys().(*syscall.Stat_t)
+		rdev, ok := procfs.Rdev(fi)
+		if !ok {
+			continue
+		}
+
 		t := TTY{
-			// Rdev is type uint32 on mips arch so we have to cast to uint64
-			Minor: minDevNum(uint64(s.Rdev)),
-			Major: majDevNum(uint64(s.Rdev)),
+			Minor: minDevNum(rdev),
+			Major: majDevNum(rdev),
 			Path:  dev,
 		}
 
@@ -83,7 +73,7 @@ func minDevNum(rdev uint64) uint64 {
 	return (rdev & 0xff) | ((rdev >> 12) & 0xfff00)
 }
 
-func FindTTY(ttyNr uint64, devices *[]TTY) (*TTY, error) {
+func FindTTY(fsys procfs.FS, ttyNr uint64, devices *[]TTY) (*TTY, error) {
 	// (man 5 proc) The minor device number is contained in the combination
 	// of bits 31 to 20 and 7 to 0; the major device number is in bits 15
 	// to 8.
@@ -91,7 +81,7 @@ func FindTTY(ttyNr uint64, devices *[]TTY) (*TTY, error) {
 	min := (ttyNr & 0xFF) | ((ttyNr >> 20) & 0xFFF)
 
 	if devices == nil {
-		devs, err := TTYs()
+		devs, err := TTYs(fsys)
 		if err != nil {
 			return nil, err
 		}
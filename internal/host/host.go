@@ -3,23 +3,36 @@ package host
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+var (
+	bootTimeMu sync.Mutex
+	// bootTimes caches the boot time of each procfs.FS.
+	bootTimes = make(map[procfs.FS]int64)
 )
 
 // BootTime parses /proc/uptime returns the boot time in seconds since the
 // Epoch, 1970-01-01 00:00:00 +0000 (UTC).
-func BootTime() (int64, error) {
-	if bootTime != nil {
-		return *bootTime, nil
+func BootTime(fsys procfs.FS) (int64, error) {
+	bootTimeMu.Lock()
+	defer bootTimeMu.Unlock()
+
+	if bootTime, ok := bootTimes[fsys]; ok {
+		return bootTime, nil
 	}
 
-	f, err := os.Open("/proc/stat")
+	f, err := fsys.Open("/proc/stat")
 	if err != nil {
 		return 0, err
 	}
 
+	defer f.Close()
+
 	btimeStr := ""
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
@@ -42,6 +55,69 @@ func BootTime() (int64, error) {
 		return 0, fmt.Errorf("error parsing boot time from /proc/stat: %s", err)
 	}
 
-	bootTime = &btimeSec
+	bootTimes[fsys] = btimeSec
 	return btimeSec, nil
 }
+
+// LoadAverage parses /proc/loadavg and returns the system load averaged over
+// the last 1, 5 and 15 minutes.
+func LoadAverage(fsys procfs.FS) ([3]float64, error) {
+	var load [3]float64
+
+	data, err := fsys.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("unexpected input from /proc/loadavg: %q", string(data))
+	}
+
+	for i := range load {
+		load[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return load, fmt.Errorf("error parsing load average from /proc/loadavg: %s", err)
+		}
+	}
+
+	return load, nil
+}
+
+// MemTotal parses /proc/meminfo and returns the total usable memory in
+// bytes.
+func MemTotal(fsys procfs.FS) (uint64, error) {
+	f, err := fsys.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+
+		kib, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing total memory from /proc/meminfo: %s", err)
+		}
+
+		return kib * 1024, nil
+	}
+
+	return 0, fmt.Errorf("couldn't extract total memory from /proc/meminfo")
+}
+
+// ClockTicksOf returns sysconf(SC_CLK_TCK) of the host of fsys, which is
+// recorded in an archive and otherwise that of the running host.
+func ClockTicksOf(fsys procfs.FS) (int64, error) {
+	if a, ok := fsys.(*procfs.Archive); ok && a.ClockTicks > 0 {
+		return a.ClockTicks, nil
+	}
+
+	return ClockTicks()
+}
@@ -7,7 +7,6 @@ import "C"
 
 var (
 	clockTicks *int64
-	bootTime   *int64
 )
 
 func ClockTicks() (int64, error) {
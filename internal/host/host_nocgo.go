@@ -11,7 +11,6 @@ import (
 
 var (
 	clockTicks *int64
-	bootTime   *int64
 )
 
 func getNativeEndianness() binary.ByteOrder {
@@ -2,15 +2,16 @@ package proc
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
 )
 
-func ParseAttrCurrent(pid string) (string, error) {
-	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/attr/current", pid))
+func ParseAttrCurrent(fsys procfs.FS, pid string) (string, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%s/attr/current", pid))
 	if err != nil {
-		_, err = os.Stat(fmt.Sprintf("/proc/%s", pid))
+		_, err = fsys.Stat(fmt.Sprintf("/proc/%s", pid))
 		if os.IsNotExist(err) {
 			// PID doesn't exist
 			return "", err
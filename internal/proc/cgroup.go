@@ -0,0 +1,251 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// Cgroup is an entry of /proc/$pid/cgroup.
+type Cgroup struct {
+	// HierarchyID is the ID of the cgroup v1 hierarchy or 0 for cgroup v2.
+	HierarchyID int
+	// Controllers are the controllers bound to the hierarchy, which are
+	// empty for cgroup v2.
+	Controllers []string
+	// Path is the path of the cgroup relative to the root of its
+	// hierarchy.
+	Path string
+}
+
+// ParseCgroups parses /proc/$pid/cgroup.
+func ParseCgroups(fsys procfs.FS, pid string) ([]Cgroup, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%s/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	cgroups := []Cgroup{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing cgroup hierarchy ID %q of PID %s: %s", fields[0], pid, err)
+		}
+
+		c := Cgroup{HierarchyID: id, Path: fields[2]}
+		if fields[1] != "" {
+			c.Controllers = strings.Split(fields[1], ",")
+		}
+
+		cgroups = append(cgroups, c)
+	}
+
+	return cgroups, nil
+}
+
+// Path returns the path of the cgroup of cgroups, which is that of the
+// unified hierarchy of cgroup v2 or hybrid hosts and otherwise that of the
+// name=systemd or, lacking it, first hierarchy of cgroup v1.
+func Path(cgroups []Cgroup) string {
+	path := ""
+	for _, c := range cgroups {
+		switch {
+		case c.HierarchyID == 0 && len(c.Controllers) == 0:
+			return c.Path
+		case path == "":
+			path = c.Path
+		}
+
+		for _, controller := range c.Controllers {
+			if controller == "name=systemd" {
+				path = c.Path
+			}
+		}
+	}
+
+	return path
+}
+
+// ControllerPath returns the path of the cgroup of controller (e.g.,
+// "memory") in cgroups relative to cgroups.CgroupRoot, which is the path of
+// the unified hierarchy if unified is set and otherwise that of the cgroup v1
+// hierarchy of the controller below the directory named after it.  It
+// returns an empty string if the controller isn't bound to any hierarchy.
+func ControllerPath(cgroups []Cgroup, controller string, unified bool) string {
+	for _, c := range cgroups {
+		if unified {
+			if c.HierarchyID == 0 {
+				return c.Path
+			}
+			continue
+		}
+
+		for _, ctrl := range c.Controllers {
+			if ctrl == controller {
+				return path.Join(controller, c.Path)
+			}
+		}
+	}
+
+	return ""
+}
+
+// Container identifies the container of a process.
+type Container struct {
+	// ID is the ID of the container, which is a 64-digit hexadecimal ID
+	// or, for systemd-nspawn, the name of the machine.
+	ID string
+	// Runtime is the container engine, i.e., "docker", "podman",
+	// "containerd", "cri-o", "systemd-nspawn" or "kubernetes" for
+	// Kubernetes pods of unknown runtime.
+	Runtime string
+}
+
+// containerScopes are the prefixes and suffixes container engines put
+// around the container ID in the names of cgroups (e.g.,
+// "docker-$id.scope" with the systemd cgroup driver or "libpod-$id" with
+// cgroupfs).
+var containerScopes = []struct {
+	prefix, suffix, runtime string
+}{
+	{"docker-", ".scope", "docker"},
+	{"libpod-", ".scope", "podman"},
+	{"libpod-", "", "podman"},
+	{"cri-containerd-", ".scope", "containerd"},
+	{"crio-", ".scope", "cri-o"},
+	{"crio-", "", "cri-o"},
+}
+
+// DetectContainer returns the container the cgroups belong to, which is
+// derived from the cgroup path conventions of docker, podman, containerd,
+// CRI-O and systemd-nspawn.  The ID is empty if the process doesn't run in
+// a recognized container.  The unified hierarchy is examined before the
+// cgroup v1 hierarchies.
+func DetectContainer(cgroups []Cgroup) Container {
+	paths := []string{Path(cgroups)}
+	for _, c := range cgroups {
+		paths = append(paths, c.Path)
+	}
+
+	for _, path := range paths {
+		if container := detectContainer(path); container.ID != "" {
+			return container
+		}
+	}
+
+	return Container{}
+}
+
+// detectContainer returns the container of the cgroup at path, whose most
+// nested component naming a container wins (e.g., for processes in a
+// nested "init" cgroup of a container).
+func detectContainer(path string) Container {
+	components := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(components) - 1; i >= 0; i-- {
+		name := components[i]
+
+		// conmon monitors a container from outside of it
+		if strings.Contains(name, "-conmon-") {
+			return Container{}
+		}
+
+		for _, scope := range containerScopes {
+			if !strings.HasPrefix(name, scope.prefix) || !strings.HasSuffix(name, scope.suffix) {
+				continue
+			}
+
+			id := strings.TrimSuffix(strings.TrimPrefix(name, scope.prefix), scope.suffix)
+			if isContainerID(id) {
+				return Container{ID: id, Runtime: scope.runtime}
+			}
+		}
+
+		if strings.HasPrefix(name, "systemd-nspawn@") && strings.HasSuffix(name, ".service") {
+			machine := strings.TrimSuffix(strings.TrimPrefix(name, "systemd-nspawn@"), ".service")
+			return Container{ID: unescapeUnitName(machine), Runtime: "systemd-nspawn"}
+		}
+
+		// machines registered with systemd-machined other than virtual
+		// machines of libvirt
+		if strings.HasPrefix(name, "machine-") && strings.HasSuffix(name, ".scope") {
+			machine := unescapeUnitName(strings.TrimSuffix(strings.TrimPrefix(name, "machine-"), ".scope"))
+			if !strings.HasPrefix(machine, "qemu-") {
+				return Container{ID: machine, Runtime: "systemd-nspawn"}
+			}
+		}
+
+		if isContainerID(name) {
+			return Container{ID: name, Runtime: bareIDRuntime(components[:i])}
+		}
+	}
+
+	return Container{}
+}
+
+// bareIDRuntime returns the runtime of a container whose cgroup is named by
+// its bare ID with the cgroupfs driver below the cgroups parents.
+func bareIDRuntime(parents []string) string {
+	for _, parent := range parents {
+		if strings.HasPrefix(parent, "kubepods") {
+			return "kubernetes"
+		}
+	}
+
+	switch {
+	case len(parents) > 0 && parents[len(parents)-1] == "docker":
+		return "docker"
+	case len(parents) > 0 && parents[len(parents)-1] == "libpod_parent":
+		return "podman"
+	case len(parents) == 1:
+		// containerd puts containers below the cgroup of their
+		// containerd namespace (e.g., "/default/$id")
+		return "containerd"
+	default:
+		return ""
+	}
+}
+
+// unescapeUnitName reverses the "\xNN" escaping of systemd unit names
+// (e.g., "my\x2dmachine").
+func unescapeUnitName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if strings.HasPrefix(name[i:], "\\x") && i+4 <= len(name) {
+			if c, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(name[i])
+	}
+
+	return b.String()
+}
+
+// isContainerID returns true if s is a 64-digit hexadecimal ID.
+func isContainerID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -3,11 +3,12 @@ package proc
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
+
+	"github.com/scmn-dev/ps/internal/procfs"
 )
 
-func ParseCmdLine(pid string) ([]string, error) {
-	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/cmdline", pid))
+func ParseCmdLine(fsys procfs.FS, pid string) ([]string, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%s/cmdline", pid))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,106 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// FD is an open file descriptor of a process.
+type FD struct {
+	// Num is the number of the file descriptor.
+	Num int
+	// Target is the destination of /proc/$pid/fd/$num, which is a path or
+	// a pseudo file such as "socket:[12345]" or "pipe:[12345]".
+	Target string
+	// Mode is the file mode of the target or 0 if it cannot be determined.
+	Mode os.FileMode
+	// Pos is the file offset.
+	Pos int64
+	// Flags are the flags the file was opened with (e.g., O_RDWR).
+	Flags int
+}
+
+// CountFDs returns the number of open file descriptors of pid.  Reading
+// /proc/$pid/fd requires permission to trace pid.
+func CountFDs(fsys procfs.FS, pid string) (int, error) {
+	names, err := fsys.ReadDirNames(fmt.Sprintf("/proc/%s/fd", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(names), nil
+}
+
+// ParseFDs parses the open file descriptors of pid from /proc/$pid/fd and
+// /proc/$pid/fdinfo in ascending order.  File descriptors closed while
+// parsing are skipped.
+func ParseFDs(fsys procfs.FS, pid string) ([]FD, error) {
+	nums, err := readIDs(fsys, fmt.Sprintf("/proc/%s/fd", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	fds := []FD{}
+	for _, num := range nums {
+		fd, err := parseFD(fsys, pid, num)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		fds = append(fds, *fd)
+	}
+
+	return fds, nil
+}
+
+// parseFD parses the file descriptor num of pid.
+func parseFD(fsys procfs.FS, pid, num string) (*FD, error) {
+	path := fmt.Sprintf("/proc/%s/fd/%s", pid, num)
+	target, err := fsys.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := &FD{Target: target}
+	fd.Num, _ = strconv.Atoi(num)
+	if fi, err := fsys.Stat(path); err == nil {
+		fd.Mode = fi.Mode()
+	}
+
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%s/fdinfo/%s", pid, num))
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "pos:":
+			fd.Pos, err = strconv.ParseInt(fields[1], 10, 64)
+		case "flags:":
+			var flags int64
+			flags, err = strconv.ParseInt(fields[1], 8, 64)
+			fd.Flags = int(flags)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s of %s: %s", fields[0], path, err)
+		}
+	}
+
+	return fd, nil
+}
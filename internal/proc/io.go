@@ -0,0 +1,70 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// IO holds the I/O counters of /proc/$pid/io.
+type IO struct {
+	// Rchar and Wchar are the bytes read and written via syscalls,
+	// including reads from and writes to the page cache.
+	Rchar uint64
+	Wchar uint64
+	// Syscr and Syscw are the number of read and write syscalls.
+	Syscr uint64
+	Syscw uint64
+	// ReadBytes and WriteBytes are the bytes fetched from and sent to the
+	// storage layer.
+	ReadBytes  uint64
+	WriteBytes uint64
+	// CancelledWriteBytes are the bytes whose write-back was cancelled by
+	// truncating dirty page cache.
+	CancelledWriteBytes uint64
+}
+
+// ParseIO parses /proc/$pid/io.  Reading it requires permission to trace
+// pid.
+func ParseIO(fsys procfs.FS, pid string) (*IO, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%s/io", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	io := &IO{}
+	fields := map[string]*uint64{
+		"rchar":                 &io.Rchar,
+		"wchar":                 &io.Wchar,
+		"syscr":                 &io.Syscr,
+		"syscw":                 &io.Syscw,
+		"read_bytes":            &io.ReadBytes,
+		"write_bytes":           &io.WriteBytes,
+		"cancelled_write_bytes": &io.CancelledWriteBytes,
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key, value := kv[0], kv[1]
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		*field, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s of /proc/%s/io: %s", key, pid, err)
+		}
+	}
+
+	return io, nil
+}
@@ -0,0 +1,77 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// Unlimited is the value of a Limit without bound.
+const Unlimited = math.MaxUint64
+
+// Limit is a resource limit of a process.
+type Limit struct {
+	Soft uint64
+	Hard uint64
+}
+
+// Limits are the resource limits of a process keyed by their name in
+// /proc/$pid/limits (e.g., "Max open files").
+type Limits map[string]Limit
+
+// ParseLimits parses /proc/$pid/limits.
+func ParseLimits(fsys procfs.FS, pid string) (Limits, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%s/limits", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("unexpected input from /proc/%s/limits", pid)
+	}
+
+	// the columns are aligned with the header
+	header := scanner.Text()
+	soft := strings.Index(header, "Soft Limit")
+	hard := strings.Index(header, "Hard Limit")
+	units := strings.Index(header, "Units")
+	if soft < 0 || hard < soft || units < hard {
+		return nil, fmt.Errorf("unexpected header in /proc/%s/limits: %q", pid, header)
+	}
+
+	limits := Limits{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < units {
+			continue
+		}
+
+		name := strings.TrimSpace(line[:soft])
+		limit := Limit{}
+		if limit.Soft, err = parseLimit(line[soft:hard]); err != nil {
+			return nil, fmt.Errorf("error parsing %q of /proc/%s/limits: %s", name, pid, err)
+		}
+		if limit.Hard, err = parseLimit(line[hard:units]); err != nil {
+			return nil, fmt.Errorf("error parsing %q of /proc/%s/limits: %s", name, pid, err)
+		}
+		limits[name] = limit
+	}
+
+	return limits, nil
+}
+
+// parseLimit parses a limit, which is either a number or "unlimited".
+func parseLimit(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	if value == "unlimited" {
+		return Unlimited, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
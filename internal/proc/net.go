@@ -0,0 +1,234 @@
+package proc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// Socket is an entry of the socket tables in /proc/$pid/net, which list the
+// sockets of the network namespace of pid.
+type Socket struct {
+	// Proto is the protocol, i.e., "tcp", "tcp6", "udp", "udp6" or "unix".
+	Proto string
+	// Inode is the inode number linking the socket to the "socket:[inode]"
+	// file descriptors of its processes.
+	Inode uint64
+	// LocalIP and LocalPort are the local address of an inet socket.
+	LocalIP   net.IP
+	LocalPort int
+	// RemoteIP and RemotePort are the peer address of an inet socket.
+	RemoteIP   net.IP
+	RemotePort int
+	// Path is the path a unix socket is bound to or empty.
+	Path string
+	// State is the state of the socket as named by ss(8) (e.g., "LISTEN",
+	// "ESTAB" or "UNCONN").
+	State string
+}
+
+// socketTables are the files in /proc/$pid/net parsed by ParseSockets.
+var socketTables = []string{"tcp", "tcp6", "udp", "udp6", "unix"}
+
+// inetStates are the names of the states in include/net/tcp_states.h.
+var inetStates = map[string]string{
+	"01": "ESTAB",
+	"02": "SYN-SENT",
+	"03": "SYN-RECV",
+	"04": "FIN-WAIT-1",
+	"05": "FIN-WAIT-2",
+	"06": "TIME-WAIT",
+	"07": "UNCONN",
+	"08": "CLOSE-WAIT",
+	"09": "LAST-ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "SYN-RECV",
+}
+
+// unixAcceptCon is the __SO_ACCEPTCON flag of listening unix sockets.
+const unixAcceptCon = 0x10000
+
+// ParseNetNamespace returns the network namespace of pid.
+func ParseNetNamespace(fsys procfs.FS, pid string) (string, error) {
+	return fsys.Readlink(fmt.Sprintf("/proc/%s/ns/net", pid))
+}
+
+// ParseSockets parses the socket tables of the network namespace of pid.
+// Tables that don't exist (e.g., tcp6 without IPv6 support) are skipped.
+func ParseSockets(fsys procfs.FS, pid string) ([]Socket, error) {
+	sockets := []Socket{}
+	for _, proto := range socketTables {
+		path := fmt.Sprintf("/proc/%s/net/%s", pid, proto)
+		f, err := fsys.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		parse := parseInetSocket
+		if proto == "unix" {
+			parse = parseUnixSocket
+		}
+
+		scanner := bufio.NewScanner(f)
+		// skip the header
+		scanner.Scan()
+		for scanner.Scan() {
+			s, err := parse(proto, strings.Fields(scanner.Text()))
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("error parsing %s: %s", path, err)
+			}
+
+			sockets = append(sockets, *s)
+		}
+
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sockets, nil
+}
+
+// parseInetSocket parses the fields of a line of /proc/$pid/net/{tcp,udp}{,6}.
+func parseInetSocket(proto string, fields []string) (*Socket, error) {
+	if len(fields) < 10 {
+		return nil, fmt.Errorf("unexpected line %q", strings.Join(fields, " "))
+	}
+
+	s := &Socket{Proto: proto, State: inetStates[fields[3]]}
+
+	var err error
+	if s.LocalIP, s.LocalPort, err = parseInetAddr(fields[1]); err != nil {
+		return nil, err
+	}
+
+	if s.RemoteIP, s.RemotePort, err = parseInetAddr(fields[2]); err != nil {
+		return nil, err
+	}
+
+	if s.Inode, err = strconv.ParseUint(fields[9], 10, 64); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// parseInetAddr parses an address such as "0100007F:0050", whose IP is
+// written as 32-bit words in host byte order.
+func parseInetAddr(addr string) (net.IP, int, error) {
+	parts := strings.SplitN(addr, ":", 2)
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("unexpected address %q", addr)
+	}
+
+	words, err := hex.DecodeString(parts[0])
+	if err != nil || (len(words) != net.IPv4len && len(words) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("unexpected address %q", addr)
+	}
+
+	ip := make(net.IP, len(words))
+	for i := 0; i < len(words); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], hostByteOrder.Uint32(words[i:]))
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unexpected address %q", addr)
+	}
+
+	return ip, int(port), nil
+}
+
+// hostByteOrder is the byte order of the running host.
+var hostByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+
+	return binary.BigEndian
+}()
+
+// parseUnixSocket parses the fields of a line of /proc/$pid/net/unix.
+func parseUnixSocket(proto string, fields []string) (*Socket, error) {
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("unexpected line %q", strings.Join(fields, " "))
+	}
+
+	flags, err := strconv.ParseUint(fields[3], 16, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Socket{Proto: proto}
+	switch {
+	case flags&unixAcceptCon != 0:
+		s.State = "LISTEN"
+	case fields[5] == "03":
+		s.State = "ESTAB"
+	default:
+		s.State = "UNCONN"
+	}
+
+	if s.Inode, err = strconv.ParseUint(fields[6], 10, 64); err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 7 {
+		s.Path = fields[7]
+	}
+
+	return s, nil
+}
+
+// SocketInodes returns the inode numbers of the sockets pid has open, which
+// are the targets of the "socket:[inode]" links in /proc/$pid/fd.  Reading
+// them requires permission to trace pid.
+func SocketInodes(fsys procfs.FS, pid string) ([]uint64, error) {
+	nums, err := readIDs(fsys, fmt.Sprintf("/proc/%s/fd", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := []uint64{}
+	for _, num := range nums {
+		target, err := fsys.Readlink(fmt.Sprintf("/proc/%s/fd/%s", pid, num))
+		if err != nil {
+			// the file descriptor has been closed meanwhile
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if !strings.HasPrefix(target, "socket:[") || !strings.HasSuffix(target, "]") {
+			continue
+		}
+
+		inode, err := strconv.ParseUint(target[len("socket:["):len(target)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing socket inode %q: %s", target, err)
+		}
+
+		inodes = append(inodes, inode)
+	}
+
+	return inodes, nil
+}
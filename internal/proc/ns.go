@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
 
 	"github.com/pkg/errors"
 )
@@ -15,8 +19,38 @@ type IDMap struct {
 	Size        int
 }
 
-func ParsePIDNamespace(pid string) (string, error) {
-	pidNS, err := os.Readlink(fmt.Sprintf("/proc/%s/ns/pid", pid))
+// NamespaceTypes are the types of the namespaces in /proc/$pid/ns.
+var NamespaceTypes = []string{"pid", "mnt", "net", "ipc", "uts", "user", "cgroup", "time"}
+
+// ParseNamespaces returns the inode numbers identifying the namespaces of pid
+// by their type (e.g., "net").  Types unsupported by the kernel are missing.
+// Reading them requires permission to trace pid.
+func ParseNamespaces(fsys procfs.FS, pid string) (map[string]uint64, error) {
+	namespaces := make(map[string]uint64)
+	for _, typ := range NamespaceTypes {
+		link, err := fsys.Readlink(fmt.Sprintf("/proc/%s/ns/%s", pid, typ))
+		if err != nil {
+			// e.g., time namespaces before Linux 5.6
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		// the link reads "$type:[$inode]"
+		inode := strings.TrimSuffix(strings.TrimPrefix(link, typ+":["), "]")
+		namespaces[typ], err = strconv.ParseUint(inode, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing namespace %q of PID %s", link, pid)
+		}
+	}
+
+	return namespaces, nil
+}
+
+func ParsePIDNamespace(fsys procfs.FS, pid string) (string, error) {
+	pidNS, err := fsys.Readlink(fmt.Sprintf("/proc/%s/ns/pid", pid))
 	if err != nil {
 		return "", err
 	}
@@ -24,8 +58,8 @@ func ParsePIDNamespace(pid string) (string, error) {
 	return pidNS, nil
 }
 
-func ParseUserNamespace(pid string) (string, error) {
-	userNS, err := os.Readlink(fmt.Sprintf("/proc/%s/ns/user", pid))
+func ParseUserNamespace(fsys procfs.FS, pid string) (string, error) {
+	userNS, err := fsys.Readlink(fmt.Sprintf("/proc/%s/ns/user", pid))
 	if err != nil {
 		return "", err
 	}
@@ -33,8 +67,8 @@ func ParseUserNamespace(pid string) (string, error) {
 	return userNS, nil
 }
 
-func ReadMappings(path string) ([]IDMap, error) {
-	file, err := os.Open(path)
+func ReadMappings(fsys procfs.FS, path string) ([]IDMap, error) {
+	file, err := fsys.Open(path)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot open %s", path)
 	}
@@ -3,38 +3,58 @@ package proc
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/scmn-dev/ps/internal/cgroups"
+	"github.com/scmn-dev/ps/internal/procfs"
 )
 
-// GetPIDs extracts and returns all PIDs from /proc.
-func GetPIDs() ([]string, error) {
-	procDir, err := os.Open("/proc/")
-	if err != nil {
-		return nil, err
-	}
+// GetPIDs extracts and returns all PIDs from /proc in ascending order.
+func GetPIDs(fsys procfs.FS) ([]string, error) {
+	return readIDs(fsys, "/proc")
+}
+
+// GetTIDs extracts and returns the IDs of all tasks (i.e., threads) of pid
+// from /proc/$pid/task in ascending order.
+func GetTIDs(fsys procfs.FS, pid string) ([]string, error) {
+	return readIDs(fsys, fmt.Sprintf("/proc/%s/task", pid))
+}
 
-	defer procDir.Close()
+// TaskPID returns the identifier of task tid of process pid.  It can be passed
+// to the Parse* functions in place of a pid to parse /proc/$pid/task/$tid
+// instead of /proc/$pid.
+func TaskPID(pid, tid string) string {
+	return fmt.Sprintf("%s/task/%s", pid, tid)
+}
 
-	// extract string slice of all directories in procDir
-	pidDirs, err := procDir.Readdirnames(0)
+// readIDs returns the numerical entries of dir in ascending order.
+func readIDs(fsys procfs.FS, dir string) ([]string, error) {
+	// extract string slice of all directories in dir
+	pidDirs, err := fsys.ReadDirNames(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	pids := []string{}
+	nums := []int{}
 	for _, pidDir := range pidDirs {
-		_, err := strconv.Atoi(pidDir)
+		num, err := strconv.Atoi(pidDir)
 		if err != nil {
 			// skip non-numerical entries (e.g., `/proc/softirqs`)
 			continue
 		}
 
-		pids = append(pids, pidDir)
+		nums = append(nums, num)
+	}
+
+	// sort numerically to get a stable order across runs
+	sort.Ints(nums)
+
+	pids := []string{}
+	for _, num := range nums {
+		pids = append(pids, strconv.Itoa(num))
 	}
 
 	return pids, nil
@@ -42,24 +62,24 @@ func GetPIDs() ([]string, error) {
 
 // GetPIDsFromCgroup returns a strings slice of all pids listesd in pid's pids
 // cgroup.  It automatically detects if we're running in unified mode or not.
-func GetPIDsFromCgroup(pid string) ([]string, error) {
-	unified, err := cgroups.IsCgroup2UnifiedMode()
+func GetPIDsFromCgroup(fsys procfs.FS, pid string) ([]string, error) {
+	unified, err := cgroups.IsCgroup2UnifiedMode(fsys)
 	if err != nil {
 		return nil, err
 	}
 
 	if unified {
-		return getPIDsFromCgroupV2(pid)
+		return getPIDsFromCgroupV2(fsys, pid)
 	}
 
-	return getPIDsFromCgroupV1(pid)
+	return getPIDsFromCgroupV1(fsys, pid)
 }
 
 // getPIDsFromCgroupV1 returns a strings slice of all pids listesd in pid's pids
 // cgroup.
-func getPIDsFromCgroupV1(pid string) ([]string, error) {
+func getPIDsFromCgroupV1(fsys procfs.FS, pid string) ([]string, error) {
 	// First, find the corresponding path to the PID cgroup.
-	f, err := os.Open(fmt.Sprintf("/proc/%s/cgroup", pid))
+	f, err := fsys.Open(fmt.Sprintf("/proc/%s/cgroup", pid))
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +95,7 @@ func getPIDsFromCgroupV1(pid string) ([]string, error) {
 		}
 
 		if fields[1] == "pids" {
-			cgroupPath = fmt.Sprintf("/sys/fs/cgroup/pids/%s/cgroup.procs", fields[2])
+			cgroupPath = filepath.Join(cgroups.CgroupRoot, "pids", fields[2], "cgroup.procs")
 		}
 	}
 
@@ -84,7 +104,7 @@ func getPIDsFromCgroupV1(pid string) ([]string, error) {
 	}
 
 	// Second, extract the PIDs inside the cgroup.
-	f, err = os.Open(cgroupPath)
+	f, err = fsys.Open(cgroupPath)
 	if err != nil {
 		return nil, err
 	}
@@ -102,9 +122,9 @@ func getPIDsFromCgroupV1(pid string) ([]string, error) {
 
 // getPIDsFromCgroupV2 returns a strings slice of all pids listesd in pid's pids
 // cgroup.
-func getPIDsFromCgroupV2(pid string) ([]string, error) {
+func getPIDsFromCgroupV2(fsys procfs.FS, pid string) ([]string, error) {
 	// First, find the corresponding path to the PID cgroup.
-	f, err := os.Open(fmt.Sprintf("/proc/%s/cgroup", pid))
+	f, err := fsys.Open(fmt.Sprintf("/proc/%s/cgroup", pid))
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +148,7 @@ func getPIDsFromCgroupV2(pid string) ([]string, error) {
 	}
 
 	// Second, extract the PIDs inside the cgroup.
-	f, err = os.Open(filepath.Join(cgroups.CgroupRoot, cgroupSlice, "cgroup.procs"))
+	f, err = fsys.Open(filepath.Join(cgroups.CgroupRoot, cgroupSlice, "cgroup.procs"))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,101 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// Smaps holds the memory usage of a process summed over all its mappings in
+// bytes.
+type Smaps struct {
+	// Rss is the resident memory, which counts shared pages fully.
+	Rss uint64
+	// Pss is the proportional share of the resident memory, which divides
+	// shared pages by the number of processes mapping them.
+	Pss uint64
+	// SharedClean, SharedDirty, PrivateClean and PrivateDirty split Rss
+	// by whether pages are mapped by other processes and whether they
+	// have been modified.
+	SharedClean  uint64
+	SharedDirty  uint64
+	PrivateClean uint64
+	PrivateDirty uint64
+	// AnonHugePages is the anonymous memory backed by transparent huge
+	// pages.
+	AnonHugePages uint64
+	// Swap is the swapped out anonymous memory and SwapPss its
+	// proportional share.
+	Swap    uint64
+	SwapPss uint64
+}
+
+// USS returns the unique set size, i.e., the memory freed if the process
+// exited.
+func (s *Smaps) USS() uint64 {
+	return s.PrivateClean + s.PrivateDirty
+}
+
+// ParseSmaps parses /proc/$pid/smaps_rollup or, on kernels older than 4.14
+// lacking it, sums the mappings in /proc/$pid/smaps.  Reading them requires
+// permission to trace pid.
+func ParseSmaps(fsys procfs.FS, pid string) (*Smaps, error) {
+	path := fmt.Sprintf("/proc/%s/smaps_rollup", pid)
+	data, err := fsys.ReadFile(path)
+	if os.IsNotExist(err) {
+		path = fmt.Sprintf("/proc/%s/smaps", pid)
+		data, err = fsys.ReadFile(path)
+	}
+	if err != nil {
+		// kernel threads have no mappings
+		if errors.Is(err, syscall.ESRCH) {
+			return &Smaps{}, nil
+		}
+
+		return nil, err
+	}
+
+	s := &Smaps{}
+	fields := map[string]*uint64{
+		"Rss":           &s.Rss,
+		"Pss":           &s.Pss,
+		"Shared_Clean":  &s.SharedClean,
+		"Shared_Dirty":  &s.SharedDirty,
+		"Private_Clean": &s.PrivateClean,
+		"Private_Dirty": &s.PrivateDirty,
+		"AnonHugePages": &s.AnonHugePages,
+		"Swap":          &s.Swap,
+		"SwapPss":       &s.SwapPss,
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// the header lines of the mappings don't name a known field
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key, value := kv[0], kv[1]
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		kib, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s of %s: %s", key, path, err)
+		}
+
+		*field += kib * 1024
+	}
+
+	return s, nil
+}
@@ -3,8 +3,9 @@ package proc
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
 )
 
 type Stat struct {
@@ -31,10 +32,28 @@ type Stat struct {
 	Itrealvalue string
 	Starttime string
 	Vsize string
+	Rss string
+	Rsslim string
+	Startcode string
+	Endcode string
+	Startstack string
+	Kstkesp string
+	Kstkeip string
+	Signal string
+	Blocked string
+	Sigignore string
+	Sigcatch string
+	Wchan string
+	Nswap string
+	Cnswap string
+	ExitSignal string
+	Processor string
+	RtPriority string
+	Policy string
 }
 
-var readStat = func(path string) (string, error) {
-	rawData, err := ioutil.ReadFile(path)
+var readStat = func(fsys procfs.FS, path string) (string, error) {
+	rawData, err := fsys.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
@@ -43,8 +62,8 @@ var readStat = func(path string) (string, error) {
 }
 
 // ParseStat parses the /proc/$pid/stat file and returns a Stat.
-func ParseStat(pid string) (*Stat, error) {
-	data, err := readStat(fmt.Sprintf("/proc/%s/stat", pid))
+func ParseStat(fsys procfs.FS, pid string) (*Stat, error) {
+	data, err := readStat(fsys, fmt.Sprintf("/proc/%s/stat", pid))
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +79,12 @@ func ParseStat(pid string) (*Stat, error) {
 	rest := strings.Fields(data[lastParen+1:])
 	fields := append([]string{pidstr, comm}, rest...)
 
+	// fields beyond vsize were added in later kernels and are left empty
+	// if missing
 	fieldAt := func(i int) string {
+		if i > len(fields) {
+			return ""
+		}
 		return fields[i-1]
 	}
 
@@ -88,5 +112,23 @@ func ParseStat(pid string) (*Stat, error) {
 		Itrealvalue: fieldAt(21),
 		Starttime:   fieldAt(22),
 		Vsize:       fieldAt(23),
+		Rss:         fieldAt(24),
+		Rsslim:      fieldAt(25),
+		Startcode:   fieldAt(26),
+		Endcode:     fieldAt(27),
+		Startstack:  fieldAt(28),
+		Kstkesp:     fieldAt(29),
+		Kstkeip:     fieldAt(30),
+		Signal:      fieldAt(31),
+		Blocked:     fieldAt(32),
+		Sigignore:   fieldAt(33),
+		Sigcatch:    fieldAt(34),
+		Wchan:       fieldAt(35),
+		Nswap:       fieldAt(36),
+		Cnswap:      fieldAt(37),
+		ExitSignal:  fieldAt(38),
+		Processor:   fieldAt(39),
+		RtPriority:  fieldAt(40),
+		Policy:      fieldAt(41),
 	}, nil
 }
@@ -2,11 +2,13 @@ package proc
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/scmn-dev/ps/internal/procfs"
+
 	"github.com/pkg/errors"
 )
 
@@ -66,11 +68,21 @@ type Status struct {
 	NonvoluntaryCtxtSwitches string
 }
 
-func readStatusUserNS(pid string) ([]string, error) {
-	path := fmt.Sprintf("/proc/%s/status", pid)
-	args := []string{"nsenter", "-U", "-t", pid, "cat", path}
+// readStatusUserNS reads /proc/$pid/status from within the user namespace of
+// pid via nsenter(1), which is killed once ctx is done.  As nsenter(1) reads
+// from the live system, fsys must be a procfs.Root.
+func readStatusUserNS(ctx context.Context, fsys procfs.FS, pid string) ([]string, error) {
+	root, ok := fsys.(procfs.Root)
+	if !ok {
+		return nil, errors.New("joining the user namespace requires a live /proc")
+	}
 
-	c := exec.Command(args[0], args[1:]...)
+	path := root.Path(fmt.Sprintf("/proc/%s/status", pid))
+	// pid may refer to a task (see TaskPID) but nsenter needs the process
+	target := strings.SplitN(pid, "/", 2)[0]
+	args := []string{"nsenter", "-U", "-t", target, "cat", path}
+
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
 	output, err := c.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("error executing %q: %v", strings.Join(args, " "), err)
@@ -79,13 +91,15 @@ func readStatusUserNS(pid string) ([]string, error) {
 	return strings.Split(string(output), "\n"), nil
 }
 
-func readStatusDefault(pid string) ([]string, error) {
+func readStatusDefault(fsys procfs.FS, pid string) ([]string, error) {
 	path := fmt.Sprintf("/proc/%s/status", pid)
-	f, err := os.Open(path)
+	f, err := fsys.Open(path)
 	if err != nil {
 		return nil, err
 	}
 
+	defer f.Close()
+
 	lines := []string{}
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
@@ -95,14 +109,17 @@ func readStatusDefault(pid string) ([]string, error) {
 	return lines, nil
 }
 
-func ParseStatus(pid string, joinUserNS bool) (*Status, error) {
+// ParseStatus parses /proc/$pid/status, from within the user namespace of pid
+// if joinUserNS is set.  ctx bounds the execution of nsenter(1) needed to
+// join the user namespace.
+func ParseStatus(ctx context.Context, fsys procfs.FS, pid string, joinUserNS bool) (*Status, error) {
 	var lines []string
 	var err error
 
 	if joinUserNS {
-		lines, err = readStatusUserNS(pid)
+		lines, err = readStatusUserNS(ctx, fsys, pid)
 	} else {
-		lines, err = readStatusDefault(pid)
+		lines, err = readStatusDefault(fsys, pid)
 	}
 
 	if err != nil {
@@ -0,0 +1,19 @@
+package proc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// ParseWchan parses /proc/$pid/wchan and returns the name of the kernel
+// function pid is sleeping in or "0" if it isn't sleeping.
+func ParseWchan(fsys procfs.FS, pid string) (string, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%s/wchan", pid))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,108 @@
+package process
+
+import (
+	"context"
+	"sync"
+)
+
+// parseAll calls parse for each index in [0, n) with up to concurrency calls
+// running in parallel and returns the processes of all calls in the order of
+// their indices, so the result does not depend on scheduling.  parse is
+// expected to ignore processes that vanished while being parsed.
+//
+// The first error stops all pending calls and is returned.  Once ctx is done,
+// parseAll returns the processes of all completed calls along with
+// ctx.Err().  With a concurrency of 1, parse is called on the calling
+// goroutine.
+func parseAll(ctx context.Context, n, concurrency int, parse func(i int) ([]*Process, error)) ([]*Process, error) {
+	// the calling goroutine may be locked to a thread that joined a mount
+	// namespace, whose /proc other goroutines can't see
+	if concurrency <= 1 {
+		return parseInline(ctx, n, parse)
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+
+	var (
+		results  = make([][]*Process, n)
+		errs     = make([]error, n)
+		done     = make([]bool, n)
+		indices  = make(chan int)
+		stop     = make(chan struct{})
+		stopOnce sync.Once
+		wg       sync.WaitGroup
+	)
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i], errs[i] = parse(i)
+				done[i] = true
+				if errs[i] != nil {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case indices <- i:
+		case <-stop:
+			break feed
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	processes := []*Process{}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
+			return nil, errs[i]
+		}
+
+		if done[i] {
+			processes = append(processes, results[i]...)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return processes, err
+	}
+
+	return processes, nil
+}
+
+// parseInline is parseAll calling parse one after another on the calling
+// goroutine.
+func parseInline(ctx context.Context, n int, parse func(i int) ([]*Process, error)) ([]*Process, error) {
+	processes := []*Process{}
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return processes, err
+		}
+
+		result, err := parse(i)
+		if err != nil {
+			if ctx.Err() != nil {
+				return processes, ctx.Err()
+			}
+
+			return nil, err
+		}
+
+		processes = append(processes, result...)
+	}
+
+	return processes, nil
+}
@@ -0,0 +1,64 @@
+package process
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseAllOrder(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 4, 100} {
+		processes, err := parseAll(context.Background(), 10, concurrency, func(i int) ([]*Process, error) {
+			return []*Process{{Pid: strconv.Itoa(i)}}, nil
+		})
+		if err != nil {
+			t.Fatalf("concurrency %d: %v", concurrency, err)
+		}
+
+		if len(processes) != 10 {
+			t.Fatalf("concurrency %d: got %d processes, want 10", concurrency, len(processes))
+		}
+		for i, p := range processes {
+			if p.Pid != strconv.Itoa(i) {
+				t.Errorf("concurrency %d: process %d has PID %s", concurrency, i, p.Pid)
+			}
+		}
+	}
+}
+
+func TestParseAllInlineOnCallingThread(t *testing.T) {
+	// processes of a joined mount namespace are only visible to the
+	// thread that joined it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	tid := unix.Gettid()
+	_, err := parseAll(context.Background(), 5, 1, func(i int) ([]*Process, error) {
+		if got := unix.Gettid(); got != tid {
+			t.Errorf("parsed process %d on thread %d, want %d", i, got, tid)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseAllCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	processes, err := parseAll(ctx, 10, 1, func(i int) ([]*Process, error) {
+		if i == 2 {
+			cancel()
+		}
+		return []*Process{{Pid: strconv.Itoa(i)}}, nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if len(processes) != 3 {
+		t.Errorf("got %d processes, want the 3 parsed before cancelling", len(processes))
+	}
+}
@@ -1,12 +1,15 @@
 package process
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/scmn-dev/ps/internal/host"
 	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/procfs"
 
 	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/pkg/errors"
@@ -14,110 +17,382 @@ import (
 
 type Process struct {
 	Pid string
+	// Tid is the ID of the task (i.e., thread) if the Process describes a
+	// single thread of process Pid and empty otherwise.
+	Tid string
 	Stat proc.Stat
+	// StatTime is the time Stat was read.
+	StatTime time.Time
 	Status proc.Status
 	CmdLine []string
 	Label string
+	// Wchan is the kernel function the process is sleeping in, "0" if it
+	// isn't sleeping or empty if it cannot be read.
+	Wchan string
+	// IO holds the I/O counters or nil if they cannot be read.
+	IO *proc.IO
+	// NFD is the number of open file descriptors or -1 if it cannot be
+	// read.
+	NFD int
+	// Limits are the resource limits or nil if they cannot be read.
+	Limits proc.Limits
+	// SocketInodes are the inode numbers of the open sockets or nil if
+	// they cannot be read.
+	SocketInodes []uint64
+	// Smaps is the memory usage summed over all mappings or nil if it
+	// cannot be read.
+	Smaps *proc.Smaps
+	// Cgroups are the cgroups the process belongs to.
+	Cgroups []proc.Cgroup
+	// Namespaces are the inode numbers of the namespaces by type (e.g.,
+	// "net") or nil if they cannot be read.
+	Namespaces map[string]uint64
+	// NetNS is the network namespace or empty if it cannot be read.
+	NetNS string
 	PidNS string
 	Huser string
 	Hgroup string
+	// fsys is the file system the process was parsed from.
+	fsys procfs.FS
+	// parsed are the sources parsed so far and joinUserNS tells how
+	// status was parsed.
+	parsed     Source
+	joinUserNS bool
 }
 
-func LookupGID(gid string) (string, error) {
+// LookupGID returns the name of group gid in /etc/group of fsys or gid if
+// it cannot be found.
+func LookupGID(fsys procfs.FS, gid string) (string, error) {
 	gidNum, err := strconv.Atoi(gid)
 	if err != nil {
 		return "", errors.Wrap(err, "error parsing group ID")
 	}
 
-	g, err := user.LookupGid(gidNum)
+	f, err := fsys.Open("/etc/group")
 	if err != nil {
 		return gid, nil
 	}
 
-	return g.Name, nil
+	defer f.Close()
+
+	groups, err := user.ParseGroupFilter(f, func(g user.Group) bool {
+		return g.Gid == gidNum
+	})
+	if err != nil || len(groups) == 0 {
+		return gid, nil
+	}
+
+	return groups[0].Name, nil
 }
 
-func LookupUID(uid string) (string, error) {
+// LookupUID returns the name of user uid in /etc/passwd of fsys or uid if it
+// cannot be found.
+func LookupUID(fsys procfs.FS, uid string) (string, error) {
 	uidNum, err := strconv.Atoi(uid)
 	if err != nil {
 		return "", errors.Wrap(err, "error parsing user ID")
 	}
 
-	u, err := user.LookupUid(uidNum)
+	f, err := fsys.Open("/etc/passwd")
 	if err != nil {
 		return uid, nil
 	}
 
-	return u.Name, nil
+	defer f.Close()
+
+	users, err := user.ParsePasswdFilter(f, func(u user.User) bool {
+		return u.Uid == uidNum
+	})
+	if err != nil || len(users) == 0 {
+		return uid, nil
+	}
+
+	return users[0].Name, nil
+}
+
+// Source is a set of files in /proc/$pid a Process is parsed from.
+type Source uint
+
+const (
+	// SourceStat is /proc/$pid/stat, which is always parsed.
+	SourceStat Source = 1 << iota
+	// SourceStatus is /proc/$pid/status.
+	SourceStatus
+	// SourceCmdLine is /proc/$pid/cmdline.
+	SourceCmdLine
+	// SourcePIDNamespace is /proc/$pid/ns/pid.
+	SourcePIDNamespace
+	// SourceLabel is /proc/$pid/attr/current.
+	SourceLabel
+	// SourceWchan is /proc/$pid/wchan.
+	SourceWchan
+	// SourceIO is /proc/$pid/io.
+	SourceIO
+	// SourceFD is /proc/$pid/fd.
+	SourceFD
+	// SourceLimits is /proc/$pid/limits.
+	SourceLimits
+	// SourceSockets are the socket links in /proc/$pid/fd and
+	// /proc/$pid/ns/net.
+	SourceSockets
+	// SourceSmaps is /proc/$pid/smaps_rollup or /proc/$pid/smaps.
+	SourceSmaps
+	// SourceCgroup is /proc/$pid/cgroup.
+	SourceCgroup
+	// SourceNamespaces are the links in /proc/$pid/ns.
+	SourceNamespaces
+
+	// SourceAll are all sources.
+	SourceAll = SourceStat | SourceStatus | SourceCmdLine | SourcePIDNamespace | SourceLabel | SourceWchan | SourceIO | SourceFD | SourceLimits | SourceSockets | SourceSmaps | SourceCgroup | SourceNamespaces
+)
+
+// New returns a new Process with the specified pid and parses the specified
+// sources from /proc and /dev.
+func New(ctx context.Context, pid string, sources Source, joinUserNS bool) (*Process, error) {
+	return parse(ctx, Process{Pid: pid, fsys: procfs.Host}, sources, joinUserNS)
 }
 
-// New returns a new Process with the specified pid and parses the relevant
-// data from /proc and /dev.
-func New(pid string, joinUserNS bool) (*Process, error) {
-	p := Process{Pid: pid}
+// NewTask returns a new Process for the task (i.e., thread) tid of process pid
+// and parses the specified sources from /proc/$pid/task/$tid.
+func NewTask(ctx context.Context, pid, tid string, sources Source, joinUserNS bool) (*Process, error) {
+	return parse(ctx, Process{Pid: pid, Tid: tid, fsys: procfs.Host}, sources, joinUserNS)
+}
 
+// parse parses the specified sources of p.  The fields of all other sources
+// are left empty.
+func parse(ctx context.Context, p Process, sources Source, joinUserNS bool) (*Process, error) {
+	// stat is parsed unconditionally as it's cheap and tells whether the
+	// process still exists
 	if err := p.parseStat(); err != nil {
 		return nil, err
 	}
+	p.parsed, p.joinUserNS = SourceStat, joinUserNS
 
-	if err := p.parseStatus(joinUserNS); err != nil {
+	if err := p.Require(ctx, sources); err != nil {
 		return nil, err
 	}
 
-	if err := p.parseCmdLine(); err != nil {
-		return nil, err
+	return &p, nil
+}
+
+// Require parses the sources of p that haven't been parsed yet, which allows
+// for reading sources on demand (e.g., for registered descriptors).
+func (p *Process) Require(ctx context.Context, sources Source) error {
+	sources &^= p.parsed
+	if sources == 0 {
+		return nil
 	}
 
-	if err := p.parsePIDNamespace(); err != nil {
-		// Ignore permission errors as those occur for some pids when
-		// the caller has limited permissions.
-		if !os.IsPermission(err) {
-			return nil, err
+	if sources&SourceStatus != 0 {
+		if err := p.parseStatus(ctx, p.joinUserNS); err != nil {
+			return err
 		}
 	}
 
-	if err := p.parseLabel(); err != nil {
-		return nil, err
+	if sources&SourceCmdLine != 0 {
+		if err := p.parseCmdLine(); err != nil {
+			return err
+		}
 	}
 
-	return &p, nil
+	if sources&SourcePIDNamespace != 0 {
+		if err := p.parsePIDNamespace(); err != nil {
+			// Ignore permission errors as those occur for some pids when
+			// the caller has limited permissions.
+			if !os.IsPermission(err) {
+				return err
+			}
+		}
+	}
+
+	if sources&SourceLabel != 0 {
+		if err := p.parseLabel(); err != nil {
+			return err
+		}
+	}
+
+	if sources&SourceWchan != 0 {
+		if err := p.parseWchan(); err != nil {
+			// wchan is restricted to processes the caller may trace
+			if !os.IsPermission(err) {
+				return err
+			}
+		}
+	}
+
+	if sources&SourceIO != 0 {
+		if err := p.parseIO(); err != nil {
+			// the I/O counters are restricted to processes the caller
+			// may trace
+			if !os.IsPermission(err) {
+				return err
+			}
+		}
+	}
+
+	if sources&SourceFD != 0 {
+		p.parseFDs()
+	}
+
+	if sources&SourceLimits != 0 {
+		if err := p.parseLimits(); err != nil {
+			if !os.IsPermission(err) {
+				return err
+			}
+		}
+	}
+
+	if sources&SourceSockets != 0 {
+		if err := p.parseSockets(); err != nil {
+			// the file descriptors are restricted to processes the
+			// caller may trace
+			if !os.IsPermission(err) {
+				return err
+			}
+		}
+	}
+
+	if sources&SourceSmaps != 0 {
+		if err := p.parseSmaps(); err != nil {
+			// the mappings are restricted to processes the caller may
+			// trace and missing from archives for kernel threads
+			if !os.IsPermission(err) && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	if sources&SourceCgroup != 0 {
+		if err := p.parseCgroups(); err != nil {
+			return err
+		}
+	}
+
+	if sources&SourceNamespaces != 0 {
+		if err := p.parseNamespaces(); err != nil {
+			// the namespaces are restricted to processes the caller
+			// may trace
+			if !os.IsPermission(err) {
+				return err
+			}
+		}
+	}
+
+	p.parsed |= sources
+	return nil
+}
+
+// Options control how FromPIDs and TasksFromPIDs parse processes.
+type Options struct {
+	// JoinUserNS parses /proc/$pid/status from within the user namespace
+	// of each process.
+	JoinUserNS bool
+
+	// Concurrency is the maximum number of processes parsed in parallel.
+	// Values below 1 parse one process after another.
+	Concurrency int
+
+	// Sources are the files to parse for each process.  /proc/$pid/stat is
+	// parsed in any case.
+	Sources Source
+
+	// FS is the file system to parse the processes from.  It defaults to
+	// procfs.Host if nil.
+	FS procfs.FS
 }
 
-// FromPIDs creates a new Process for each pid.
-func FromPIDs(pids []string, joinUserNS bool) ([]*Process, error) {
-	processes := []*Process{}
-	for _, pid := range pids {
-		p, err := New(pid, joinUserNS)
+// fs returns the file system to parse processes from.
+func (o *Options) fs() procfs.FS {
+	if o.FS == nil {
+		return procfs.Host
+	}
+
+	return o.FS
+}
+
+// FromPIDs creates a new Process for each pid.  The processes are returned
+// in the order of pids.  Once ctx is done, it returns the processes created
+// so far along with ctx.Err().
+func FromPIDs(ctx context.Context, pids []string, opts Options) ([]*Process, error) {
+	return parseAll(ctx, len(pids), opts.Concurrency, func(i int) ([]*Process, error) {
+		p, err := parse(ctx, Process{Pid: pids[i], fsys: opts.fs()}, opts.Sources, opts.JoinUserNS)
 		if err != nil {
 			if os.IsNotExist(errors.Cause(err)) {
 				// proc parsing is racy
 				// Let's ignore "does not exist" errors
-				continue
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		return []*Process{p}, nil
+	})
+}
+
+// TasksFromPIDs creates a new Process for each task (i.e., thread) of each
+// pid.  The tasks are returned in the order of pids and, for each pid, in
+// ascending order.  Once ctx is done, it returns the processes created so
+// far along with ctx.Err().
+func TasksFromPIDs(ctx context.Context, pids []string, opts Options) ([]*Process, error) {
+	return parseAll(ctx, len(pids), opts.Concurrency, func(i int) ([]*Process, error) {
+		tids, err := proc.GetTIDs(opts.fs(), pids[i])
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				return nil, nil
 			}
 
 			return nil, err
 		}
 
-		processes = append(processes, p)
+		tasks := []*Process{}
+		for _, tid := range tids {
+			p, err := parse(ctx, Process{Pid: pids[i], Tid: tid, fsys: opts.fs()}, opts.Sources, opts.JoinUserNS)
+			if err != nil {
+				if os.IsNotExist(errors.Cause(err)) {
+					continue
+				}
+
+				return nil, err
+			}
+
+			tasks = append(tasks, p)
+		}
+
+		return tasks, nil
+	})
+}
+
+// procID returns the identifier to pass to the parsers in proc, which is
+// either the pid or, for tasks, a proc.TaskPID.
+func (p *Process) procID() string {
+	if p.Tid == "" {
+		return p.Pid
 	}
 
-	return processes, nil
+	return proc.TaskPID(p.Pid, p.Tid)
+}
+
+// ReadFile reads the file name in /proc/$pid or, for tasks, in
+// /proc/$pid/task/$tid.
+func (p *Process) ReadFile(name string) ([]byte, error) {
+	return p.fsys.ReadFile(fmt.Sprintf("/proc/%s/%s", p.procID(), name))
 }
 
 // parseStat parses /proc/$pid/stat.
 func (p *Process) parseStat() error {
-	s, err := proc.ParseStat(p.Pid)
+	s, err := proc.ParseStat(p.fsys, p.procID())
 	if err != nil {
 		return err
 	}
 
-	p.Stat = *s
+	p.Stat, p.StatTime = *s, procfs.Now(p.fsys)
 	return nil
 }
 
 // parseStatus parses /proc/$pid/status.
-func (p *Process) parseStatus(joinUserNS bool) error {
-	s, err := proc.ParseStatus(p.Pid, joinUserNS)
+func (p *Process) parseStatus(ctx context.Context, joinUserNS bool) error {
+	s, err := proc.ParseStatus(ctx, p.fsys, p.procID(), joinUserNS)
 	if err != nil {
 		return err
 	}
@@ -128,7 +403,7 @@ func (p *Process) parseStatus(joinUserNS bool) error {
 
 // parseCmdLine parses /proc/$pid/cmdline.
 func (p *Process) parseCmdLine() error {
-	s, err := proc.ParseCmdLine(p.Pid)
+	s, err := proc.ParseCmdLine(p.fsys, p.procID())
 	if err != nil {
 		return err
 	}
@@ -139,7 +414,7 @@ func (p *Process) parseCmdLine() error {
 
 // parsePIDNamespace sets the PID namespace.
 func (p *Process) parsePIDNamespace() error {
-	pidNS, err := proc.ParsePIDNamespace(p.Pid)
+	pidNS, err := proc.ParsePIDNamespace(p.fsys, p.procID())
 	if err != nil {
 		return err
 	}
@@ -150,7 +425,7 @@ func (p *Process) parsePIDNamespace() error {
 
 // parseLabel parses the security label.
 func (p *Process) parseLabel() error {
-	label, err := proc.ParseAttrCurrent(p.Pid)
+	label, err := proc.ParseAttrCurrent(p.fsys, p.procID())
 	if err != nil {
 		return err
 	}
@@ -159,16 +434,115 @@ func (p *Process) parseLabel() error {
 	return nil
 }
 
+// parseWchan parses /proc/$pid/wchan.
+func (p *Process) parseWchan() error {
+	wchan, err := proc.ParseWchan(p.fsys, p.procID())
+	if err != nil {
+		return err
+	}
+
+	p.Wchan = wchan
+	return nil
+}
+
+// parseIO parses /proc/$pid/io.
+func (p *Process) parseIO() error {
+	io, err := proc.ParseIO(p.fsys, p.procID())
+	if err != nil {
+		return err
+	}
+
+	p.IO = io
+	return nil
+}
+
+// parseFDs counts the open file descriptors in /proc/$pid/fd, which are
+// shared by all threads.  They cannot be counted for processes the caller
+// may not trace or that weren't captured with their file descriptors.
+func (p *Process) parseFDs() {
+	nfd, err := proc.CountFDs(p.fsys, p.Pid)
+	if err != nil {
+		p.NFD = -1
+		return
+	}
+
+	p.NFD = nfd
+}
+
+// parseLimits parses /proc/$pid/limits.
+func (p *Process) parseLimits() error {
+	limits, err := proc.ParseLimits(p.fsys, p.procID())
+	if err != nil {
+		return err
+	}
+
+	p.Limits = limits
+	return nil
+}
+
+// parseSockets parses the network namespace and the inode numbers of the
+// sockets in /proc/$pid/fd, which are shared by all threads.
+func (p *Process) parseSockets() error {
+	netNS, err := proc.ParseNetNamespace(p.fsys, p.Pid)
+	if err != nil {
+		return err
+	}
+
+	p.NetNS = netNS
+
+	inodes, err := proc.SocketInodes(p.fsys, p.Pid)
+	if err != nil {
+		return err
+	}
+
+	p.SocketInodes = inodes
+	return nil
+}
+
+// parseSmaps parses the memory usage of the mappings, which are shared by
+// all threads.
+func (p *Process) parseSmaps() error {
+	smaps, err := proc.ParseSmaps(p.fsys, p.Pid)
+	if err != nil {
+		return err
+	}
+
+	p.Smaps = smaps
+	return nil
+}
+
+// parseCgroups parses /proc/$pid/cgroup.
+func (p *Process) parseCgroups() error {
+	cgroups, err := proc.ParseCgroups(p.fsys, p.procID())
+	if err != nil {
+		return err
+	}
+
+	p.Cgroups = cgroups
+	return nil
+}
+
+// parseNamespaces parses the links in /proc/$pid/ns.
+func (p *Process) parseNamespaces() error {
+	namespaces, err := proc.ParseNamespaces(p.fsys, p.procID())
+	if err != nil {
+		return err
+	}
+
+	p.Namespaces = namespaces
+	return nil
+}
+
 // SetHostData sets all host-related data fields.
 func (p *Process) SetHostData() error {
 	var err error
 
-	p.Huser, err = LookupUID(p.Status.Uids[1])
+	p.Huser, err = LookupUID(p.fsys, p.Status.Uids[1])
 	if err != nil {
 		return err
 	}
 
-	p.Hgroup, err = LookupGID(p.Status.Gids[1])
+	p.Hgroup, err = LookupGID(p.fsys, p.Status.Gids[1])
 	if err != nil {
 		return err
 	}
@@ -176,35 +550,36 @@ func (p *Process) SetHostData() error {
 	return nil
 }
 
-// ElapsedTime returns the time.Duration since process p was created.
+// ElapsedTime returns the time.Duration since process p was created, which
+// for archives is relative to the time of the capture.
 func (p *Process) ElapsedTime() (time.Duration, error) {
 	startTime, err := p.StartTime()
 	if err != nil {
 		return 0, err
 	}
 
-	return time.Since(startTime), nil
+	return procfs.Now(p.fsys).Sub(startTime), nil
 }
 
-// StarTime returns the time.Time when process p was started.
+// StartTime returns the time.Time when process p was started.
 func (p *Process) StartTime() (time.Time, error) {
 	sinceBoot, err := strconv.ParseInt(p.Stat.Starttime, 10, 64)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	clockTicks, err := host.ClockTicks()
+	clockTicks, err := host.ClockTicksOf(p.fsys)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	bootTime, err := host.BootTime()
+	bootTime, err := host.BootTime(p.fsys)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	sinceBoot = sinceBoot / clockTicks
-	return time.Unix(sinceBoot+bootTime, 0), nil
+	secs, ticks := sinceBoot/clockTicks, sinceBoot%clockTicks
+	return time.Unix(bootTime+secs, ticks*int64(time.Second)/clockTicks), nil
 }
 
 // CPUTime returns the cumlative CPU time of process p as a time.Duration.
@@ -219,12 +594,11 @@ func (p *Process) CPUTime() (time.Duration, error) {
 		return 0, err
 	}
 
-	clockTicks, err := host.ClockTicks()
+	clockTicks, err := host.ClockTicksOf(p.fsys)
 	if err != nil {
 		return 0, err
 	}
 
-	secs := (user + system) / clockTicks
-	cpu := time.Unix(secs, 0)
-	return cpu.Sub(time.Unix(0, 0)), nil
+	secs, ticks := (user+system)/clockTicks, (user+system)%clockTicks
+	return time.Duration(secs)*time.Second + time.Duration(ticks*int64(time.Second)/clockTicks), nil
 }
@@ -0,0 +1,433 @@
+package procfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// archiveMetadata is the name of the metadata file in an archive.
+	archiveMetadata = "delta-capture.json"
+	// archiveVersion is the version of the archive layout.
+	archiveVersion = 1
+	// paxErrno is the PAX record holding the errno reading a file failed
+	// with during the capture.
+	paxErrno = "DELTA.errno"
+	// maxLinks is the maximum number of symbolic links followed.
+	maxLinks = 8
+)
+
+type archiveMeta struct {
+	Version    int       `json:"version"`
+	Time       time.Time `json:"time"`
+	ClockTicks int64     `json:"clockTicks"`
+}
+
+// ArchiveWriter captures files of an FS to a gzip-compressed tar archive,
+// which can be read via ReadArchive.
+type ArchiveWriter struct {
+	src FS
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	at  time.Time
+}
+
+// NewArchiveWriter returns an ArchiveWriter capturing the files of src to w.
+// t is the time of the capture and clockTicks sysconf(SC_CLK_TCK) of the
+// captured host.
+func NewArchiveWriter(w io.Writer, src FS, t time.Time, clockTicks int64) (*ArchiveWriter, error) {
+	gz := gzip.NewWriter(w)
+	a := &ArchiveWriter{src: src, gz: gz, tw: tar.NewWriter(gz), at: t}
+
+	meta, err := json.Marshal(archiveMeta{Version: archiveVersion, Time: t, ClockTicks: clockTicks})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.write(&tar.Header{Typeflag: tar.TypeReg, Name: archiveMetadata, Mode: 0644}, meta); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// AddFile captures the content of the file name.  Files that don't exist are
+// skipped, while other errors reading them are recorded to be returned when
+// reading name from the archive.
+func (a *ArchiveWriter) AddFile(name string) error {
+	data, err := a.src.ReadFile(name)
+	if err != nil {
+		return a.addError(name, err)
+	}
+
+	return a.write(&tar.Header{Typeflag: tar.TypeReg, Name: archiveName(name), Mode: 0644}, data)
+}
+
+// AddLink captures the symbolic link name.
+func (a *ArchiveWriter) AddLink(name string) error {
+	link, err := a.src.Readlink(name)
+	if err != nil {
+		return a.addError(name, err)
+	}
+
+	return a.write(&tar.Header{Typeflag: tar.TypeSymlink, Name: archiveName(name), Linkname: link, Mode: 0777}, nil)
+}
+
+// AddDevice captures the device number of the character device name.
+func (a *ArchiveWriter) AddDevice(name string) error {
+	fi, err := a.src.Stat(name)
+	if err != nil {
+		return a.addError(name, err)
+	}
+
+	rdev, ok := Rdev(fi)
+	if !ok {
+		return nil
+	}
+
+	return a.write(&tar.Header{
+		Typeflag: tar.TypeChar,
+		Name:     archiveName(name),
+		Mode:     int64(fi.Mode().Perm()),
+		Devmajor: int64(unix.Major(rdev)),
+		Devminor: int64(unix.Minor(rdev)),
+	}, nil)
+}
+
+// AddDir captures the directory name, which is listed even if none of its
+// entries are captured.
+func (a *ArchiveWriter) AddDir(name string) error {
+	return a.write(&tar.Header{Typeflag: tar.TypeDir, Name: archiveName(name) + "/", Mode: 0755}, nil)
+}
+
+// AddDirEntries captures the directory name like AddDir and returns the
+// names of its entries for the caller to capture.  Errors reading the
+// directory are recorded like those of AddFile, in which case no names are
+// returned.
+func (a *ArchiveWriter) AddDirEntries(name string) ([]string, error) {
+	names, err := a.src.ReadDirNames(name)
+	if err != nil {
+		return nil, a.addError(name, err)
+	}
+
+	return names, a.AddDir(name)
+}
+
+// Close flushes the archive.  It does not close the underlying io.Writer.
+func (a *ArchiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+
+	return a.gz.Close()
+}
+
+// addError records err as the error of reading name.
+func (a *ArchiveWriter) addError(name string, err error) error {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return err
+	}
+
+	if errno == syscall.ENOENT || errno == syscall.ESRCH {
+		// the file or process doesn't exist (anymore)
+		return nil
+	}
+
+	return a.write(&tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       archiveName(name),
+		Mode:       0644,
+		PAXRecords: map[string]string{paxErrno: strconv.Itoa(int(errno))},
+	}, nil)
+}
+
+func (a *ArchiveWriter) write(hdr *tar.Header, data []byte) error {
+	hdr.Size = int64(len(data))
+	hdr.ModTime = a.at
+	if hdr.PAXRecords != nil {
+		hdr.Format = tar.FormatPAX
+	}
+
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := a.tw.Write(data)
+	return err
+}
+
+// archiveName returns the name of the absolute path name in an archive.
+func archiveName(name string) string {
+	return strings.TrimPrefix(path.Clean(name), "/")
+}
+
+// Archive is an FS reading from an archive written by an ArchiveWriter.
+type Archive struct {
+	// Time is the time of the capture.
+	Time time.Time
+	// ClockTicks is sysconf(SC_CLK_TCK) of the captured host.
+	ClockTicks int64
+
+	entries map[string]*archiveEntry
+}
+
+type archiveEntry struct {
+	hdr   *tar.Header
+	data  []byte
+	names []string
+	err   error
+}
+
+// OpenArchive reads the archive at path.
+func OpenArchive(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return ReadArchive(f)
+}
+
+// ReadArchive reads an archive from r.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive: %v", err)
+	}
+
+	a := &Archive{entries: map[string]*archiveEntry{"/": {hdr: &tar.Header{Typeflag: tar.TypeDir, Mode: 0755}}}}
+	meta := false
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %v", err)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %v", err)
+		}
+
+		if hdr.Name == archiveMetadata {
+			var m archiveMeta
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %v", archiveMetadata, err)
+			}
+			if m.Version != archiveVersion {
+				return nil, fmt.Errorf("unsupported archive version %d", m.Version)
+			}
+			a.Time, a.ClockTicks, meta = m.Time, m.ClockTicks, true
+			continue
+		}
+
+		e := &archiveEntry{hdr: hdr, data: data}
+		if s, ok := hdr.PAXRecords[paxErrno]; ok {
+			errno, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s of %s: %v", paxErrno, hdr.Name, err)
+			}
+			e.err = syscall.Errno(errno)
+		}
+		a.add("/"+archiveName(hdr.Name), e)
+	}
+
+	if !meta {
+		return nil, fmt.Errorf("not a capture: %s is missing", archiveMetadata)
+	}
+
+	for _, e := range a.entries {
+		sort.Strings(e.names)
+	}
+
+	return a, nil
+}
+
+// add adds e as name along with all its parent directories.
+func (a *Archive) add(name string, e *archiveEntry) {
+	if old, exists := a.entries[name]; exists {
+		// keep the entries of directories created for their children
+		e.names = old.names
+	}
+	a.entries[name] = e
+
+	for name != "/" {
+		dir := path.Dir(name)
+		parent, exists := a.entries[dir]
+		if !exists {
+			parent = &archiveEntry{hdr: &tar.Header{Typeflag: tar.TypeDir, Mode: 0755, ModTime: a.Time}}
+			a.entries[dir] = parent
+		}
+
+		base := path.Base(name)
+		for _, n := range parent.names {
+			if n == base {
+				return
+			}
+		}
+		parent.names = append(parent.names, base)
+
+		if exists {
+			return
+		}
+		name = dir
+	}
+}
+
+// lookup returns the entry of name, following symbolic links if follow is
+// set.
+func (a *Archive) lookup(op, name string, follow bool) (*archiveEntry, error) {
+	name = path.Clean("/" + name)
+	for i := 0; ; i++ {
+		e, ok := a.entries[name]
+		if !ok {
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+		}
+
+		if e.err != nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: e.err}
+		}
+
+		if !follow || e.hdr.Typeflag != tar.TypeSymlink {
+			return e, nil
+		}
+
+		if i == maxLinks {
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+
+		link := e.hdr.Linkname
+		if !path.IsAbs(link) {
+			link = path.Join(path.Dir(name), link)
+		}
+		name = link
+	}
+}
+
+// ReadFile reads the file name.
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	e, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.hdr.Typeflag == tar.TypeDir {
+		return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+
+	return e.data, nil
+}
+
+// Open opens the file name for reading.
+func (a *Archive) Open(name string) (io.ReadCloser, error) {
+	data, err := a.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ReadDirNames returns the names of the entries in the directory name.
+func (a *Archive) ReadDirNames(name string) ([]string, error) {
+	e, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.hdr.Typeflag != tar.TypeDir {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+
+	return append([]string(nil), e.names...), nil
+}
+
+// Readlink returns the destination of the symbolic link name.
+func (a *Archive) Readlink(name string) (string, error) {
+	e, err := a.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+
+	if e.hdr.Typeflag != tar.TypeSymlink {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+
+	return e.hdr.Linkname, nil
+}
+
+// Stat returns the FileInfo of name, following symbolic links.
+func (a *Archive) Stat(name string) (os.FileInfo, error) {
+	e, err := a.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return archiveFileInfo{name: path.Base(path.Clean("/" + name)), e: e}, nil
+}
+
+// archiveFileInfo is the os.FileInfo of an archive entry.
+type archiveFileInfo struct {
+	name string
+	e    *archiveEntry
+}
+
+func (fi archiveFileInfo) Name() string       { return fi.name }
+func (fi archiveFileInfo) Size() int64        { return int64(len(fi.e.data)) }
+func (fi archiveFileInfo) ModTime() time.Time { return fi.e.hdr.ModTime }
+func (fi archiveFileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi archiveFileInfo) Sys() interface{}   { return fi.e.hdr }
+
+func (fi archiveFileInfo) Mode() os.FileMode {
+	return fi.e.hdr.FileInfo().Mode()
+}
+
+// Rdev returns the device number of the device file fi describes.  It
+// returns false if fi doesn't describe a device.
+func Rdev(fi os.FileInfo) (uint64, bool) {
+	if fi.Mode()&os.ModeDevice == 0 {
+		return 0, false
+	}
+
+	switch s := fi.Sys().(type) {
+	case *syscall.Stat_t:
+		// Rdev is type uint32 on mips arch so we have to cast to uint64
+		return uint64(s.Rdev), true
+	case *tar.Header:
+		return unix.Mkdev(uint32(s.Devmajor), uint32(s.Devminor)), true
+	}
+
+	return 0, false
+}
+
+// Now returns the current time of fsys, which is the time of the capture for
+// an Archive.
+func Now(fsys FS) time.Time {
+	if a, ok := fsys.(*Archive); ok {
+		return a.Time
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,128 @@
+package procfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FS provides read access to the proc, sys and dev file systems as well as
+// /etc of a host.  Names are always the absolute paths these file systems
+// have on the host (e.g., "/proc/1/stat" or "/etc/passwd"), regardless of
+// where an FS actually reads them from.
+type FS interface {
+	// ReadFile reads the file name.
+	ReadFile(name string) ([]byte, error)
+	// Open opens the file name for reading.
+	Open(name string) (io.ReadCloser, error)
+	// ReadDirNames returns the names of the entries in the directory name.
+	ReadDirNames(name string) ([]string, error)
+	// Readlink returns the destination of the symbolic link name.
+	Readlink(name string) (string, error)
+	// Stat returns the FileInfo of name, following symbolic links.
+	Stat(name string) (os.FileInfo, error)
+}
+
+// Root is an FS reading from the directories the proc, sys and dev file
+// systems and /etc are mounted at.  Empty directories default to the ones of
+// Host.
+type Root struct {
+	// Proc is the mount point of proc (e.g., "/host/proc").
+	Proc string
+	// Sys is the mount point of sys.
+	Sys string
+	// Dev is the mount point of dev.
+	Dev string
+	// Etc is the directory of the host's /etc (e.g., "/host/etc").
+	Etc string
+}
+
+// Host is the FS of the host the caller is running on.
+var Host = Root{Proc: "/proc", Sys: "/sys", Dev: "/dev", Etc: "/etc"}
+
+// NewRoot returns a Root for the specified mount points, where empty ones
+// default to those of Host.  If proc is mounted elsewhere, etc defaults to
+// the /etc of the host's init process if it is accessible, so that users and
+// groups are resolved on the host they belong to.
+func NewRoot(proc, sys, dev, etc string) Root {
+	r := Root{Proc: proc, Sys: sys, Dev: dev, Etc: etc}.withDefaults()
+	if etc == "" && filepath.Clean(r.Proc) != Host.Proc {
+		// the root of another process requires ptrace access
+		hostEtc := filepath.Join(r.Proc, "1/root/etc")
+		if fi, err := os.Stat(hostEtc); err == nil && fi.IsDir() {
+			r.Etc = hostEtc
+		}
+	}
+
+	return r
+}
+
+// withDefaults returns r with the empty mount points set to those of Host.
+func (r Root) withDefaults() Root {
+	if r.Proc == "" {
+		r.Proc = Host.Proc
+	}
+	if r.Sys == "" {
+		r.Sys = Host.Sys
+	}
+	if r.Dev == "" {
+		r.Dev = Host.Dev
+	}
+	if r.Etc == "" {
+		r.Etc = Host.Etc
+	}
+
+	return r
+}
+
+// Path returns the path of name below the mount points of r.  Names outside
+// of /proc, /sys, /dev and /etc are returned unchanged.
+func (r Root) Path(name string) string {
+	r = r.withDefaults()
+	for _, m := range []struct{ host, root string }{
+		{Host.Proc, r.Proc},
+		{Host.Sys, r.Sys},
+		{Host.Dev, r.Dev},
+		{Host.Etc, r.Etc},
+	} {
+		if name == m.host || strings.HasPrefix(name, m.host+"/") {
+			return filepath.Join(m.root, strings.TrimPrefix(name, m.host))
+		}
+	}
+
+	return name
+}
+
+// ReadFile reads the file name.
+func (r Root) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(r.Path(name))
+}
+
+// Open opens the file name for reading.
+func (r Root) Open(name string) (io.ReadCloser, error) {
+	return os.Open(r.Path(name))
+}
+
+// ReadDirNames returns the names of the entries in the directory name.
+func (r Root) ReadDirNames(name string) ([]string, error) {
+	dir, err := os.Open(r.Path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	defer dir.Close()
+
+	return dir.Readdirnames(0)
+}
+
+// Readlink returns the destination of the symbolic link name.
+func (r Root) Readlink(name string) (string, error) {
+	return os.Readlink(r.Path(name))
+}
+
+// Stat returns the FileInfo of name, following symbolic links.
+func (r Root) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(r.Path(name))
+}
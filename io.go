@@ -0,0 +1,57 @@
+package ps
+
+import (
+	"strconv"
+
+	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/process"
+)
+
+// The I/O counters of proc.IO.
+func ioRchar(io *proc.IO) uint64               { return io.Rchar }
+func ioWchar(io *proc.IO) uint64               { return io.Wchar }
+func ioSyscr(io *proc.IO) uint64               { return io.Syscr }
+func ioSyscw(io *proc.IO) uint64               { return io.Syscw }
+func ioReadBytes(io *proc.IO) uint64           { return io.ReadBytes }
+func ioWriteBytes(io *proc.IO) uint64          { return io.WriteBytes }
+func ioCancelledWriteBytes(io *proc.IO) uint64 { return io.CancelledWriteBytes }
+
+// processIO returns a valueFunc extracting the I/O counter field of a
+// process, which is nil if the counters cannot be read (e.g., for processes
+// of other users).
+func processIO(field func(*proc.IO) uint64) valueFunc {
+	return func(p *process.Process, ctx *psContext) (interface{}, error) {
+		if p.IO == nil {
+			return nil, nil
+		}
+
+		return field(p.IO), nil
+	}
+}
+
+// processIORate returns a valueFunc extracting the per-second rate of the
+// I/O counter field of a process since the previous listing with the same
+// Sampler, which is nil without a Sampler or previous listing.
+func processIORate(field func(*proc.IO) uint64) valueFunc {
+	return func(p *process.Process, ctx *psContext) (interface{}, error) {
+		if ctx.sampler == nil {
+			return nil, nil
+		}
+
+		rate, ok := ctx.sampler.ioRate(p, field)
+		if !ok {
+			return nil, nil
+		}
+
+		return rate, nil
+	}
+}
+
+// formatRate renders a rate per second without decimals.
+func formatRate(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', 0, 64)
+	}
+
+	return formatValue(value)
+}
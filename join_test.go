@@ -0,0 +1,55 @@
+package ps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJoinNamespaceListsJoinedProcesses checks that joining the mount
+// namespace of a process in its own pid namespace lists the processes of
+// that namespace instead of the host's.
+func TestJoinNamespaceListsJoinedProcesses(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("joining namespaces requires root")
+	}
+
+	cmd := exec.Command("unshare", "--pid", "--fork", "--mount-proc", "sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot create pid namespace: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// the sleep is forked by unshare into the new namespaces
+	var pid string
+	for start := time.Now(); pid == "" && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/children", cmd.Process.Pid, cmd.Process.Pid))
+		if err != nil {
+			t.Skipf("cannot read children of unshare: %v", err)
+		}
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			pid = fields[0]
+		}
+	}
+	if pid == "" {
+		t.Skip("unshare didn't fork")
+	}
+	// wait for /proc to be mounted in the namespace
+	time.Sleep(100 * time.Millisecond)
+
+	rows, err := JoinNamespaceAndProcessRows(pid, []string{"pid", "comm"})
+	if err != nil {
+		t.Skipf("cannot join namespace of PID %s: %v", pid, err)
+	}
+
+	if len(rows) != 1 || rows[0]["pid"] != 1 || rows[0]["comm"] != "sleep" {
+		t.Fatalf("got %v, want only the sleep as PID 1", rows)
+	}
+}
@@ -0,0 +1,142 @@
+package ps
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/process"
+)
+
+// ErrInvalidUnit is returned when parsing an unknown memory unit.
+var ErrInvalidUnit = errors.New("invalid unit")
+
+// Unit is the unit the values of memory descriptors (e.g., "rss" or "pss")
+// are rendered in.  Their typed values are always in bytes.
+type Unit int
+
+const (
+	// UnitKiB renders memory in KiB like procps.
+	UnitKiB Unit = iota
+	// UnitMiB renders memory in MiB.
+	UnitMiB
+	// UnitGiB renders memory in GiB.
+	UnitGiB
+	// UnitHuman renders memory in the largest unit the value is at least
+	// one of, suffixed with its letter (e.g., "512K", "1.5M" or "12G").
+	UnitHuman
+)
+
+// unitNames are the names of the units accepted by ParseUnit.
+var unitNames = map[string]Unit{
+	"kib":   UnitKiB,
+	"mib":   UnitMiB,
+	"gib":   UnitGiB,
+	"human": UnitHuman,
+}
+
+// ParseUnit parses the name of a Unit, i.e., "kib", "mib", "gib" or "human".
+func ParseUnit(name string) (Unit, error) {
+	unit, ok := unitNames[strings.ToLower(name)]
+	if !ok {
+		return 0, errors.Wrapf(ErrInvalidUnit, "'%s' (supported: kib, mib, gib, human)", name)
+	}
+
+	return unit, nil
+}
+
+// formatMemory renders a value in bytes in unit.
+func formatMemory(value interface{}, unit Unit) string {
+	b, ok := value.(uint64)
+	if !ok {
+		return formatValue(value)
+	}
+
+	// limits that aren't set (e.g., "memory_max")
+	if b == Unlimited {
+		return "max"
+	}
+
+	switch unit {
+	case UnitMiB:
+		return strconv.FormatUint(b>>20, 10)
+	case UnitGiB:
+		return strconv.FormatUint(b>>30, 10)
+	case UnitHuman:
+		size, suffix := float64(b)/1024, "KMGTP"
+		for len(suffix) > 1 && size >= 1024 {
+			size, suffix = size/1024, suffix[1:]
+		}
+		if size < 10 && suffix[0] != 'K' {
+			return fmt.Sprintf("%.1f%c", size, suffix[0])
+		}
+		return fmt.Sprintf("%.0f%c", size, suffix[0])
+	default:
+		return strconv.FormatUint(b>>10, 10)
+	}
+}
+
+// The memory fields of proc.Status in kB.
+func statusVMPeak(s *proc.Status) string       { return s.VMPeak }
+func statusVMHWM(s *proc.Status) string        { return s.VMHWM }
+func statusVMData(s *proc.Status) string       { return s.VMData }
+func statusVMStk(s *proc.Status) string        { return s.VMStk }
+func statusVMExe(s *proc.Status) string        { return s.VMExe }
+func statusVMLib(s *proc.Status) string        { return s.VMLib }
+func statusVMPTE(s *proc.Status) string        { return s.VMPTE }
+func statusVMSwap(s *proc.Status) string       { return s.VMSwap }
+func statusVMLCK(s *proc.Status) string        { return s.VMLCK }
+func statusVMPin(s *proc.Status) string        { return s.VMPin }
+func statusRssAnon(s *proc.Status) string      { return s.RssAnon }
+func statusRssFile(s *proc.Status) string      { return s.RssFile }
+func statusRssShmem(s *proc.Status) string     { return s.RssShmem }
+func statusHugetlbPages(s *proc.Status) string { return s.HugetlbPages }
+
+// processStatusMemory returns a valueFunc extracting the memory field of
+// /proc/$pid/status of a process in bytes.
+func processStatusMemory(field func(*proc.Status) string) valueFunc {
+	return func(p *process.Process, ctx *psContext) (interface{}, error) {
+		return statusMemory(field(&p.Status))
+	}
+}
+
+// statusMemory converts a memory field of /proc/$pid/status in kB to bytes.
+// Fields missing for kernel threads are 0.
+func statusMemory(kB string) (interface{}, error) {
+	if kB == "" {
+		return uint64(0), nil
+	}
+
+	kib, err := strconv.ParseUint(kB, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return kib * 1024, nil
+}
+
+// The memory usage of proc.Smaps.
+func smapsPss(s *proc.Smaps) uint64          { return s.Pss }
+func smapsUss(s *proc.Smaps) uint64          { return s.USS() }
+func smapsSwap(s *proc.Smaps) uint64         { return s.Swap }
+func smapsSwapPss(s *proc.Smaps) uint64      { return s.SwapPss }
+func smapsAnonHuge(s *proc.Smaps) uint64     { return s.AnonHugePages }
+func smapsSharedClean(s *proc.Smaps) uint64  { return s.SharedClean }
+func smapsPrivateDirty(s *proc.Smaps) uint64 { return s.PrivateDirty }
+
+// processSmaps returns a valueFunc extracting the memory usage field of a
+// process, which is nil if the mappings cannot be read (e.g., for processes
+// of other users).  Unlike rss, the proportional and unique set sizes don't
+// count shared pages fully in every process and can thus be summed over
+// processes (e.g., of a container).
+func processSmaps(field func(*proc.Smaps) uint64) valueFunc {
+	return func(p *process.Process, ctx *psContext) (interface{}, error) {
+		if p.Smaps == nil {
+			return nil, nil
+		}
+
+		return field(p.Smaps), nil
+	}
+}
@@ -0,0 +1,22 @@
+package ps
+
+import (
+	"github.com/scmn-dev/ps/internal/process"
+)
+
+// processNamespace returns a valueFunc extracting the inode number of the
+// namespace of type typ (e.g., "net") of a process, which is nil if it
+// cannot be read (e.g., for processes of other users).  Processes sharing a
+// namespace have the same inode number, so filtering or sorting by it
+// groups them (e.g., the containers of a pod sharing its network
+// namespace).
+func processNamespace(typ string) valueFunc {
+	return func(p *process.Process, ctx *psContext) (interface{}, error) {
+		inode, ok := p.Namespaces[typ]
+		if !ok {
+			return nil, nil
+		}
+
+		return inode, nil
+	}
+}
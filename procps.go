@@ -0,0 +1,401 @@
+package ps
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/scmn-dev/ps/internal/host"
+	"github.com/scmn-dev/ps/internal/process"
+)
+
+// procpsAlias maps a procps-ng `ps -o` keyword to the descriptor providing
+// its value.
+type procpsAlias struct {
+	normal string
+	header string
+	// format overrides the descriptor's formatFunc if set.
+	format formatFunc
+}
+
+// procpsAliases are the procps-ng keywords without a descriptor of the same
+// name.  Values are keyed by the descriptor's name in a Row.
+var procpsAliases = map[string]procpsAlias{
+	"%cpu":       {normal: "pcpu", header: "%CPU", format: formatPercent},
+	"c":          {normal: "pcpu", header: "C", format: formatPercentInt},
+	"%mem":       {normal: "pmem", header: "%MEM"},
+	"cmd":        {normal: "args", header: "CMD"},
+	"command":    {normal: "args", header: "COMMAND"},
+	"ucmd":       {normal: "comm", header: "CMD"},
+	"ucomm":      {normal: "comm", header: "COMMAND"},
+	"euser":      {normal: "user", header: "EUSER"},
+	"uname":      {normal: "user", header: "USER"},
+	"egroup":     {normal: "group", header: "EGROUP"},
+	"euid":       {normal: "uid", header: "EUID"},
+	"egid":       {normal: "gid", header: "EGID"},
+	"svuid":      {normal: "suid", header: "SVUID"},
+	"svgid":      {normal: "sgid", header: "SVGID"},
+	"fsuser":     {normal: "fuser", header: "FSUSER"},
+	"fsgroup":    {normal: "fgroup", header: "FSGROUP"},
+	"pgrp":       {normal: "pgid", header: "PGRP"},
+	"sess":       {normal: "sid", header: "SESS"},
+	"session":    {normal: "sid", header: "SESS"},
+	"lwp":        {normal: "tid", header: "LWP"},
+	"spid":       {normal: "tid", header: "SPID"},
+	"thcount":    {normal: "nlwp", header: "THCNT"},
+	"ni":         {normal: "nice", header: "NI"},
+	"s":          {normal: "state", header: "S"},
+	"tt":         {normal: "tty", header: "TT"},
+	"vsize":      {normal: "vsz", header: "VSZ"},
+	"rssize":     {normal: "rss", header: "RSS"},
+	"rsz":        {normal: "rss", header: "RSZ"},
+	"cputime":    {normal: "time", header: "TIME"},
+	"cputimes":   {normal: "times", header: "TIME"},
+	"lstart":     {normal: "stime", header: "STARTED", format: formatLStart},
+	"start_time": {normal: "stime", header: "START"},
+	"class":      {normal: "cls", header: "CLS"},
+	"policy":     {normal: "cls", header: "POL"},
+	"flag":       {normal: "f", header: "F"},
+	"flags":      {normal: "f", header: "F"},
+	"maj_flt":    {normal: "majflt", header: "MAJFLT"},
+	"min_flt":    {normal: "minflt", header: "MINFLT"},
+	"sig":        {normal: "pending", header: "PENDING"},
+	"sigmask":    {normal: "blocked", header: "BLOCKED"},
+	"sigignore":  {normal: "ignored", header: "IGNORED"},
+	"sigcatch":   {normal: "caught", header: "CAUGHT"},
+}
+
+// lookupAlias returns the descriptor of the procps-ng keyword name with the
+// keyword's header and format.  The caller must hold descriptorsMu.
+func lookupAlias(name string) (aixFormatDescriptor, bool) {
+	alias, ok := procpsAliases[name]
+	if !ok {
+		return aixFormatDescriptor{}, false
+	}
+
+	for _, aix := range aixFormatDescriptors {
+		if aix.normal != alias.normal {
+			continue
+		}
+
+		aix.header = alias.header
+		// the format of the alias replaces any of the descriptor
+		if alias.format != nil {
+			aix.format, aix.formatAt = alias.format, nil
+		}
+		return aix, true
+	}
+
+	return aixFormatDescriptor{}, false
+}
+
+// formatPercent renders a percentage with one decimal like procps-ng.
+func formatPercent(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', 1, 64)
+	}
+
+	return formatValue(value)
+}
+
+// formatPercentInt renders a percentage as truncated integer.
+func formatPercentInt(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.Itoa(int(f))
+	}
+
+	return formatValue(value)
+}
+
+// formatDash renders nil values, which denote values not applicable to a
+// process, as "-".
+func formatDash(value interface{}) string {
+	if value == nil {
+		return "-"
+	}
+
+	return formatValue(value)
+}
+
+// formatEmptyDash renders empty strings, which denote values a process
+// lacks (e.g., the ports of a process listening on none), as "-".
+func formatEmptyDash(value interface{}) string {
+	if value == "" {
+		return "-"
+	}
+
+	return formatValue(value)
+}
+
+// statusID returns the i-th ID of ids from /proc/$pid/status, which are the
+// real, effective, saved and file system IDs.
+func statusID(ids []string, i int) (interface{}, error) {
+	if len(ids) <= i {
+		return nil, nil
+	}
+
+	return strconv.Atoi(ids[i])
+}
+
+func processUID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Uids, 1)
+}
+
+func processRUID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Uids, 0)
+}
+
+func processSUID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Uids, 2)
+}
+
+func processFSUID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Uids, 3)
+}
+
+func processGID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Gids, 1)
+}
+
+func processRGID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Gids, 0)
+}
+
+func processSGID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Gids, 2)
+}
+
+func processFSGID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusID(p.Status.Gids, 3)
+}
+
+func processSUSER(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupUID(ctx.fsys, p.Status.Uids[2])
+}
+
+func processFUSER(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupUID(ctx.fsys, p.Status.Uids[3])
+}
+
+func processSGROUP(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupGID(ctx.fsys, p.Status.Gids[2])
+}
+
+func processFGROUP(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupGID(ctx.fsys, p.Status.Gids[3])
+}
+
+// processSUPGID returns the supplementary group IDs of process p separated
+// by commas.
+func processSUPGID(p *process.Process, ctx *psContext) (interface{}, error) {
+	if len(p.Status.Groups) == 0 {
+		return "-", nil
+	}
+
+	return strings.Join(p.Status.Groups, ","), nil
+}
+
+// processSUPGRP returns the supplementary group names of process p separated
+// by commas.
+func processSUPGRP(p *process.Process, ctx *psContext) (interface{}, error) {
+	if len(p.Status.Groups) == 0 {
+		return "-", nil
+	}
+
+	names := []string{}
+	for _, gid := range p.Status.Groups {
+		name, err := process.LookupGID(ctx.fsys, gid)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ","), nil
+}
+
+// processSID returns the session ID of process p.
+func processSID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Session)
+}
+
+// processTPGID returns the process group ID of the foreground process group
+// on the terminal of process p or -1 if it has no terminal.
+func processTPGID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Tpgid)
+}
+
+// processSZ returns the virtual memory size of process p in pages.
+func processSZ(p *process.Process, ctx *psContext) (interface{}, error) {
+	vsize, err := strconv.ParseUint(p.Stat.Vsize, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return int(vsize / uint64(os.Getpagesize())), nil
+}
+
+// processPSR returns the processor process p last ran on.
+func processPSR(p *process.Process, ctx *psContext) (interface{}, error) {
+	if p.Stat.Processor == "" {
+		return nil, nil
+	}
+
+	return strconv.Atoi(p.Stat.Processor)
+}
+
+// processF returns the procps-ng process flags of process p, i.e., 1 for
+// forked but didn't exec and 4 for used super-user privileges.
+func processF(p *process.Process, ctx *psContext) (interface{}, error) {
+	flags, err := strconv.ParseUint(p.Stat.Flags, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return int(flags>>6) & 0x7, nil
+}
+
+// processMAJFLT returns the number of major page faults of process p.
+func processMAJFLT(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Majflt)
+}
+
+// processMINFLT returns the number of minor page faults of process p.
+func processMINFLT(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Minflt)
+}
+
+// processWCHAN returns the kernel function process p is sleeping in or "-"
+// if it is running.
+func processWCHAN(p *process.Process, ctx *psContext) (interface{}, error) {
+	switch p.Wchan {
+	case "":
+		return nil, nil
+	case "0":
+		return "-", nil
+	default:
+		return p.Wchan, nil
+	}
+}
+
+// schedulingClasses are the procps-ng names of the scheduling policies.
+var schedulingClasses = []string{"TS", "FF", "RR", "B", "ISO", "IDL", "DLN"}
+
+// processCLS returns the scheduling class of process p.
+func processCLS(p *process.Process, ctx *psContext) (interface{}, error) {
+	policy, err := strconv.Atoi(p.Stat.Policy)
+	if err != nil || policy < 0 || policy >= len(schedulingClasses) {
+		return nil, nil
+	}
+
+	return schedulingClasses[policy], nil
+}
+
+// processPRI returns the priority of process p as shown by procps-ng, where
+// higher numbers denote lower priorities.
+func processPRI(p *process.Process, ctx *psContext) (interface{}, error) {
+	priority, err := strconv.Atoi(p.Stat.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	return 39 - priority, nil
+}
+
+// processPRIORITY returns the kernel's priority of process p.
+func processPRIORITY(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Priority)
+}
+
+// processOPRI returns the priority of process p in the historical format of
+// procps-ng's `ps -l`.
+func processOPRI(p *process.Process, ctx *psContext) (interface{}, error) {
+	priority, err := strconv.Atoi(p.Stat.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	return 60 + priority, nil
+}
+
+// processRTPRIO returns the real-time priority of process p or nil if it
+// isn't scheduled by a real-time policy.
+func processRTPRIO(p *process.Process, ctx *psContext) (interface{}, error) {
+	switch p.Stat.Policy {
+	case "1", "2", "4", "6":
+		return strconv.Atoi(p.Stat.RtPriority)
+	default:
+		return nil, nil
+	}
+}
+
+// processSTAT returns the state of process p with the BSD flags of
+// procps-ng, i.e., "<" for high and "N" for low priority, "L" for pages
+// locked into memory, "s" for session leaders, "l" for multi-threaded
+// processes and "+" for foreground process groups.
+func processSTAT(p *process.Process, ctx *psContext) (interface{}, error) {
+	stat := p.Stat.State
+
+	if nice, err := strconv.Atoi(p.Stat.Nice); err == nil {
+		if nice < 0 {
+			stat += "<"
+		} else if nice > 0 {
+			stat += "N"
+		}
+	}
+
+	if p.Status.VMLCK != "" && p.Status.VMLCK != "0" {
+		stat += "L"
+	}
+
+	if p.Stat.Session == p.Pid {
+		stat += "s"
+	}
+
+	if n, err := strconv.Atoi(p.Stat.NumThreads); err == nil && n > 1 {
+		stat += "l"
+	}
+
+	if p.Stat.Tpgid == p.Stat.Pgrp {
+		stat += "+"
+	}
+
+	return stat, nil
+}
+
+// processPMEM returns the ratio of the resident set size of process p to
+// the total memory in percent.
+func processPMEM(p *process.Process, ctx *psContext) (interface{}, error) {
+	rss, err := processRSS(p, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.memTotal == nil {
+		// read once per listing
+		memTotal, _ := host.MemTotal(ctx.fsys)
+		ctx.memTotal = &memTotal
+	}
+	memTotal := *ctx.memTotal
+	if memTotal == 0 {
+		return nil, nil
+	}
+
+	return 100 * float64(rss.(uint64)) / float64(memTotal), nil
+}
+
+func processPENDING(p *process.Process, ctx *psContext) (interface{}, error) {
+	return p.Status.SigPnd, nil
+}
+
+func processBLOCKED(p *process.Process, ctx *psContext) (interface{}, error) {
+	return p.Status.SigBlk, nil
+}
+
+func processIGNORED(p *process.Process, ctx *psContext) (interface{}, error) {
+	return p.Status.SigIgn, nil
+}
+
+func processCAUGHT(p *process.Process, ctx *psContext) (interface{}, error) {
+	return p.Status.SigCgt, nil
+}
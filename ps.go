@@ -1,19 +1,22 @@
 package ps
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"os"
 	"sort"
-	"sync"
 	"strings"
 	"strconv"
 	"runtime"
-	"io/ioutil"
+	"sync"
+	"time"
 
 	capkg "github.com/scmn-dev/ps/internal/cap"
 	"github.com/scmn-dev/ps/internal/dev"
 	"github.com/scmn-dev/ps/internal/process"
 	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/procfs"
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
@@ -24,10 +27,75 @@ type IDMap struct {
 	Size int
 }
 
+// ProcessInfoOpts are options for ProcessInfo and friends.
+type ProcessInfoOpts struct {
+	// SortKeys sorts the processes by the values of the specified
+	// descriptors, which need not be part of the listed descriptors.
+	SortKeys []SortKey
+
+	// Filter selects the processes to list.  All processes are listed if
+	// nil.
+	Filter *Filter
+
+	// Tree nests processes under their parents and indents the "args" and
+	// "comm" values with branches of the specified style.  Siblings are
+	// ordered by SortKeys.
+	Tree TreeStyle
+
+	// Sampler, if set, makes "pcpu" report the CPU usage and the I/O rate
+	// descriptors (e.g., "read_bytes_rate") report the rates since the
+	// previous listing with the same Sampler.
+	Sampler *Sampler
+
+	// Threads lists each thread (i.e., task in /proc/$pid/task) instead of
+	// each process, similar to `ps -L`.
+	Threads bool
+
+	// Concurrency is the maximum number of processes parsed in parallel.
+	// It defaults to the number of CPUs if 0.  Processes in a joined mount
+	// namespace are always parsed one after another, as only the thread
+	// that joined the namespace can see its /proc.
+	Concurrency int
+
+	// ProcRoot, SysRoot and DevRoot are the directories the host's /proc,
+	// /sys and /dev are mounted at (e.g., "/host/proc" in a sidecar
+	// container), which default to /proc, /sys and /dev if empty.  They
+	// may also point to fixture trees.  Processes in a joined mount
+	// namespace are always read from that namespace's /proc and /dev.
+	ProcRoot string
+	SysRoot string
+	DevRoot string
+	// EtcRoot is the directory of the host's /etc, whose passwd and group
+	// resolve user and group names.  It defaults to /etc or, if ProcRoot
+	// is set, to the /etc of the host's init process below ProcRoot if it
+	// is accessible.
+	EtcRoot string
+
+	// Archive, if set, lists the processes captured in the archive
+	// instead of the live ones, in which case the roots are ignored.
+	// Namespaces of archived processes cannot be joined.
+	Archive *Archive
+}
+
+// fs returns the file system described by the roots or the archive of
+// options.
+func (options *ProcessInfoOpts) fs() procfs.FS {
+	if options == nil {
+		return procfs.Host
+	}
+
+	if options.Archive != nil {
+		return options.Archive.fs
+	}
+
+	return procfs.NewRoot(options.ProcRoot, options.SysRoot, options.DevRoot, options.EtcRoot)
+}
+
 type JoinNamespaceOpts struct {
 	UIDMap []IDMap
 	GIDMap []IDMap
 	FillMappings bool
+	ProcessInfoOpts
 }
 
 type psContext struct {
@@ -35,19 +103,119 @@ type psContext struct {
 	hostProcesses []*process.Process
 	ttys *[]dev.TTY
 	opts *JoinNamespaceOpts
+	sampler *Sampler
+	// parseCtx bounds parsing the sources of processes on demand.
+	parseCtx context.Context
+	// sockets caches the socket tables of each network namespace.
+	sockets socketTables
+	// cgroups caches the files of cgroups.
+	cgroups cgroupCache
+	// memTotal caches the total memory of the host or is nil if it hasn't
+	// been read yet.  It is 0 if it cannot be read.
+	memTotal *uint64
+	// fsys is the file system the processes are parsed from.
+	fsys procfs.FS
 }
 
-type processFunc func(*process.Process, *psContext) (string, error)
+// valueFunc extracts the typed value of a descriptor from a process.
+type valueFunc func(*process.Process, *psContext) (interface{}, error)
+
+// formatFunc renders a typed descriptor value as a string.
+type formatFunc func(interface{}) string
 
 type aixFormatDescriptor struct {
 	code string
 	normal string
 	header string
 	onHost bool
-	procFn processFunc
+	procFn valueFunc
+	format formatFunc
+	// sources are the files in /proc/$pid procFn depends on.
+	sources process.Source
+	// memory marks values in bytes, which are rendered in the Unit of the
+	// Format unless format is set.
+	memory bool
+	// kind is the type of the values, against which filter literals are
+	// checked.  Memory values are numbers.
+	kind valueKind
+	// formatAt renders values relative to the time of the listing (e.g.,
+	// "stime") in place of format.
+	formatAt func(value interface{}, now time.Time) string
+}
+
+// valueKind is the type of the values of a descriptor.
+type valueKind int
+
+const (
+	// kindOther values (e.g., strings, CapSets and the values of
+	// registered descriptors) are compared by their rendering.
+	kindOther valueKind = iota
+	// kindNumber values are of type int, uint64 or float64.
+	kindNumber
+	// kindDuration values are of type time.Duration.
+	kindDuration
+	// kindTime values are of type time.Time.
+	kindTime
+)
+
+// valueKind returns the kind of the values of d.
+func (d aixFormatDescriptor) valueKind() valueKind {
+	if d.memory {
+		return kindNumber
+	}
+
+	return d.kind
+}
+
+// Row holds the typed values of one process keyed by the descriptor name
+// (e.g., "pid" or "etime").  Depending on the descriptor, values are of type
+// int, float64, uint64 (memory and I/O in bytes and limits), string,
+// time.Duration, time.Time or CapSet.  A nil value denotes that the data is
+// not available (e.g., "hpid" of a process without a corresponding host
+// process).  Limits that aren't set are Unlimited (e.g., "memory_max" and
+// "fdlimit") or, for "cpu_max", math.Inf(1).
+type Row map[string]interface{}
+
+// Unlimited is the value of limits in bytes or counts that aren't set.
+const Unlimited uint64 = math.MaxUint64
+
+// CapSet is a set of capabilities as found in /proc/$pid/status.
+type CapSet uint64
+
+// Names returns the sorted names of all capabilities in c.
+func (c CapSet) Names() []string {
+	caps := capkg.TranslateMask(uint64(c))
+	sort.Strings(caps)
+	return caps
 }
 
-func findID(idStr string, mapping []IDMap, lookupFunc func(uid string) (string, error), overflowFile string) (string, error) {
+// Has returns true if c contains the capability with the specified name
+// (e.g., "SYS_ADMIN").
+func (c CapSet) Has(name string) bool {
+	for _, n := range capkg.TranslateMask(uint64(c)) {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns "full", "none" or a comma-separated list of the names in c.
+func (c CapSet) String() string {
+	if uint64(c) == capkg.FullCAPs {
+		return "full"
+	}
+
+	caps := c.Names()
+	if len(caps) == 0 {
+		return "none"
+	}
+
+	return strings.Join(caps, ",")
+}
+
+func findID(fsys procfs.FS, idStr string, mapping []IDMap, lookupFunc func(fsys procfs.FS, uid string) (string, error), overflowFile string) (string, error) {
 	if len(mapping) == 0 {
 		return idStr, nil
 	}
@@ -61,12 +229,12 @@ func findID(idStr string, mapping []IDMap, lookupFunc func(uid string) (string,
 		if int(id) >= m.ContainerID && int(id) < m.ContainerID+m.Size {
 			user := fmt.Sprintf("%d", m.HostID+(int(id)-m.ContainerID))
 
-			return lookupFunc(user)
+			return lookupFunc(fsys, user)
 		}
 	}
 
 	// User not found, read the overflow
-	overflow, err := ioutil.ReadFile(overflowFile)
+	overflow, err := fsys.ReadFile(overflowFile)
 	if err != nil {
 		return "", errors.Wrapf(err, "cannot read %s", overflowFile)
 	}
@@ -79,19 +247,19 @@ func translateDescriptors(descriptors []string) ([]aixFormatDescriptor, error) {
 		descriptors = DefaultDescriptors
 	}
 
+	descriptorsMu.RLock()
+	defer descriptorsMu.RUnlock()
+
+	// each descriptor may be a whole format string (see Format)
 	formatDescriptors := []aixFormatDescriptor{}
 	for _, d := range descriptors {
-		d = strings.TrimSpace(d)
-		found := false
-		for _, aix := range aixFormatDescriptors {
-			if d == aix.code || d == aix.normal {
-				formatDescriptors = append(formatDescriptors, aix)
-				found = true
-			}
+		f, err := parseFormat(d)
+		if err != nil {
+			return nil, err
 		}
 
-		if !found {
-			return nil, errors.Wrapf(ErrUnknownDescriptor, "'%s'", d)
+		for _, c := range f.columns {
+			formatDescriptors = append(formatDescriptors, c.desc)
 		}
 	}
 
@@ -111,173 +279,1104 @@ var (
 			normal: "pcpu",
 			header: "CPU",
 			procFn: processPCPU,
+			kind: kindNumber,
+			sources: process.SourceStat,
 		},
 		{
 			code:   "%G",
 			normal: "group",
 			header: "GROUP",
 			procFn: processGROUP,
+			sources: process.SourceStatus,
 		},
 		{
 			code:   "%P",
 			normal: "ppid",
 			header: "PPID",
 			procFn: processPPID,
+			kind: kindNumber,
+			sources: process.SourceStat,
 		},
 		{
 			code:   "%U",
 			normal: "user",
 			header: "USER",
 			procFn: processUSER,
+			sources: process.SourceStatus,
 		},
 		{
 			code:   "%a",
 			normal: "args",
 			header: "COMMAND",
 			procFn: processARGS,
+			sources: process.SourceCmdLine,
 		},
 		{
 			code:   "%c",
 			normal: "comm",
 			header: "COMMAND",
 			procFn: processCOMM,
+			sources: process.SourceStat,
 		},
 		{
 			code:   "%g",
 			normal: "rgroup",
 			header: "RGROUP",
 			procFn: processRGROUP,
+			sources: process.SourceStatus,
 		},
 		{
 			code:   "%n",
 			normal: "nice",
 			header: "NI",
 			procFn: processNICE,
+			kind: kindNumber,
+			sources: process.SourceStat,
 		},
 		{
 			code:   "%p",
 			normal: "pid",
 			header: "PID",
 			procFn: processPID,
+			kind: kindNumber,
+			sources: process.SourceStat,
 		},
 		{
 			code:   "%r",
 			normal: "pgid",
 			header: "PGID",
 			procFn: processPGID,
+			kind: kindNumber,
+			sources: process.SourceStat,
 		},
 		{
 			code:   "%t",
 			normal: "etime",
 			header: "ELAPSED",
 			procFn: processETIME,
+			kind: kindDuration,
+			sources: process.SourceStat,
+			format: formatElapsed,
 		},
 		{
 			code:   "%u",
 			normal: "ruser",
 			header: "RUSER",
 			procFn: processRUSER,
+			sources: process.SourceStatus,
 		},
 		{
 			code:   "%x",
 			normal: "time",
 			header: "TIME",
 			procFn: processTIME,
+			kind: kindDuration,
+			sources: process.SourceStat,
+			format: formatCPUTime,
 		},
 		{
 			code:   "%y",
 			normal: "tty",
 			header: "TTY",
 			procFn: processTTY,
+			sources: process.SourceStat,
 		},
 		{
 			code:   "%z",
 			normal: "vsz",
 			header: "VSZ",
 			procFn: processVSZ,
+			sources: process.SourceStat,
+			memory: true,
 		},
 		{
 			normal: "capamb",
 			header: "AMBIENT CAPS",
 			procFn: processCAPAMB,
+			sources: process.SourceStatus,
 		},
 		{
 			normal: "capinh",
 			header: "INHERITED CAPS",
 			procFn: processCAPINH,
+			sources: process.SourceStatus,
 		},
 		{
 			normal: "capprm",
 			header: "PERMITTED CAPS",
 			procFn: processCAPPRM,
+			sources: process.SourceStatus,
 		},
 		{
 			normal: "capeff",
 			header: "EFFECTIVE CAPS",
 			procFn: processCAPEFF,
+			sources: process.SourceStatus,
 		},
 		{
 			normal: "capbnd",
 			header: "BOUNDING CAPS",
 			procFn: processCAPBND,
+			sources: process.SourceStatus,
 		},
 		{
 			normal: "seccomp",
 			header: "SECCOMP",
 			procFn: processSECCOMP,
+			sources: process.SourceStatus,
 		},
 		{
 			normal: "label",
 			header: "LABEL",
 			procFn: processLABEL,
+			sources: process.SourceLabel,
 		},
 		{
 			normal: "hpid",
 			header: "HPID",
 			onHost: true,
 			procFn: processHPID,
+			kind: kindNumber,
+			sources: process.SourcePIDNamespace,
 		},
 		{
 			normal: "huser",
 			header: "HUSER",
 			onHost: true,
 			procFn: processHUSER,
+			sources: process.SourcePIDNamespace,
 		},
 		{
 			normal: "hgroup",
 			header: "HGROUP",
 			onHost: true,
 			procFn: processHGROUP,
+			sources: process.SourcePIDNamespace,
 		},
 		{
 			normal: "rss",
 			header: "RSS",
 			procFn: processRSS,
+			sources: process.SourceStatus,
+			memory: true,
 		},
 		{
 			normal: "state",
 			header: "STATE",
 			procFn: processState,
+			sources: process.SourceStat,
 		},
 		{
 			normal: "stime",
 			header: "STIME",
 			procFn: processStartTime,
+			kind: kindTime,
+			sources: process.SourceStat,
+			formatAt: formatStartTime,
+		},
+		{
+			normal: "tid",
+			header: "TID",
+			procFn: processTID,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "nlwp",
+			header: "NLWP",
+			procFn: processNLWP,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "tname",
+			header: "THREAD",
+			procFn: processTNAME,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "etimes",
+			header: "ELAPSED",
+			procFn: processETIMES,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "times",
+			header: "TIME",
+			procFn: processTIMES,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "nfd",
+			header: "NFD",
+			procFn: processNFD,
+			kind: kindNumber,
+			sources: process.SourceFD,
+		},
+		{
+			normal: "fdlimit",
+			header: "FDLIMIT",
+			procFn: processFDLIMIT,
+			kind: kindNumber,
+			sources: process.SourceLimits,
+			format: formatMax,
+		},
+		{
+			normal: "pfd",
+			header: "%FD",
+			procFn: processPFD,
+			kind: kindNumber,
+			sources: process.SourceFD | process.SourceStatus | process.SourceLimits,
+			format: formatPercent,
+		},
+		{
+			normal: "nsockets",
+			header: "NSOCKETS",
+			procFn: processNSOCKETS,
+			kind: kindNumber,
+			sources: process.SourceSockets,
+		},
+		{
+			normal: "ports",
+			header: "PORTS",
+			procFn: processPORTS,
+			sources: process.SourceSockets,
+			format: formatEmptyDash,
+		},
+		{
+			normal: "rchar",
+			header: "RCHAR",
+			procFn: processIO(ioRchar),
+			kind: kindNumber,
+			sources: process.SourceIO,
+		},
+		{
+			normal: "wchar",
+			header: "WCHAR",
+			procFn: processIO(ioWchar),
+			kind: kindNumber,
+			sources: process.SourceIO,
+		},
+		{
+			normal: "syscr",
+			header: "SYSCR",
+			procFn: processIO(ioSyscr),
+			kind: kindNumber,
+			sources: process.SourceIO,
+		},
+		{
+			normal: "syscw",
+			header: "SYSCW",
+			procFn: processIO(ioSyscw),
+			kind: kindNumber,
+			sources: process.SourceIO,
+		},
+		{
+			normal: "read_bytes",
+			header: "READ_BYTES",
+			procFn: processIO(ioReadBytes),
+			kind: kindNumber,
+			sources: process.SourceIO,
+		},
+		{
+			normal: "write_bytes",
+			header: "WRITE_BYTES",
+			procFn: processIO(ioWriteBytes),
+			kind: kindNumber,
+			sources: process.SourceIO,
+		},
+		{
+			normal: "cancelled_write_bytes",
+			header: "CANCELLED_WRITE_BYTES",
+			procFn: processIO(ioCancelledWriteBytes),
+			kind: kindNumber,
+			sources: process.SourceIO,
+		},
+		{
+			normal: "rchar_rate",
+			header: "RCHAR/S",
+			procFn: processIORate(ioRchar),
+			kind: kindNumber,
+			sources: process.SourceIO,
+			format: formatRate,
+		},
+		{
+			normal: "wchar_rate",
+			header: "WCHAR/S",
+			procFn: processIORate(ioWchar),
+			kind: kindNumber,
+			sources: process.SourceIO,
+			format: formatRate,
+		},
+		{
+			normal: "syscr_rate",
+			header: "SYSCR/S",
+			procFn: processIORate(ioSyscr),
+			kind: kindNumber,
+			sources: process.SourceIO,
+			format: formatRate,
+		},
+		{
+			normal: "syscw_rate",
+			header: "SYSCW/S",
+			procFn: processIORate(ioSyscw),
+			kind: kindNumber,
+			sources: process.SourceIO,
+			format: formatRate,
+		},
+		{
+			normal: "read_bytes_rate",
+			header: "READ_BYTES/S",
+			procFn: processIORate(ioReadBytes),
+			kind: kindNumber,
+			sources: process.SourceIO,
+			format: formatRate,
+		},
+		{
+			normal: "write_bytes_rate",
+			header: "WRITE_BYTES/S",
+			procFn: processIORate(ioWriteBytes),
+			kind: kindNumber,
+			sources: process.SourceIO,
+			format: formatRate,
+		},
+		{
+			normal: "cancelled_write_bytes_rate",
+			header: "CANCELLED_WRITE_BYTES/S",
+			procFn: processIORate(ioCancelledWriteBytes),
+			kind: kindNumber,
+			sources: process.SourceIO,
+			format: formatRate,
+		},
+		{
+			normal: "pmem",
+			header: "%MEM",
+			procFn: processPMEM,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+			format: formatPercent,
+		},
+		{
+			normal: "uid",
+			header: "UID",
+			procFn: processUID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "ruid",
+			header: "RUID",
+			procFn: processRUID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "suid",
+			header: "SUID",
+			procFn: processSUID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "fsuid",
+			header: "FSUID",
+			procFn: processFSUID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "gid",
+			header: "GID",
+			procFn: processGID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "rgid",
+			header: "RGID",
+			procFn: processRGID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "sgid",
+			header: "SGID",
+			procFn: processSGID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "fsgid",
+			header: "FSGID",
+			procFn: processFSGID,
+			kind: kindNumber,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "suser",
+			header: "SUSER",
+			procFn: processSUSER,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "fuser",
+			header: "FUSER",
+			procFn: processFUSER,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "sgroup",
+			header: "SGROUP",
+			procFn: processSGROUP,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "fgroup",
+			header: "FGROUP",
+			procFn: processFGROUP,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "supgid",
+			header: "SUPGID",
+			procFn: processSUPGID,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "supgrp",
+			header: "SUPGRP",
+			procFn: processSUPGRP,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "sid",
+			header: "SID",
+			procFn: processSID,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "tpgid",
+			header: "TPGID",
+			procFn: processTPGID,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "sz",
+			header: "SZ",
+			procFn: processSZ,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "psr",
+			header: "PSR",
+			procFn: processPSR,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "f",
+			header: "F",
+			procFn: processF,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "majflt",
+			header: "MAJFLT",
+			procFn: processMAJFLT,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "minflt",
+			header: "MINFLT",
+			procFn: processMINFLT,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "wchan",
+			header: "WCHAN",
+			procFn: processWCHAN,
+			sources: process.SourceWchan,
+		},
+		{
+			normal: "cls",
+			header: "CLS",
+			procFn: processCLS,
+			sources: process.SourceStat,
+			format: formatDash,
+		},
+		{
+			normal: "pri",
+			header: "PRI",
+			procFn: processPRI,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "priority",
+			header: "PRI",
+			procFn: processPRIORITY,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "opri",
+			header: "PRI",
+			procFn: processOPRI,
+			kind: kindNumber,
+			sources: process.SourceStat,
+		},
+		{
+			normal: "rtprio",
+			header: "RTPRIO",
+			procFn: processRTPRIO,
+			kind: kindNumber,
+			sources: process.SourceStat,
+			format: formatDash,
+		},
+		{
+			normal: "stat",
+			header: "STAT",
+			procFn: processSTAT,
+			sources: process.SourceStat | process.SourceStatus,
+		},
+		{
+			normal: "pending",
+			header: "PENDING",
+			procFn: processPENDING,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "blocked",
+			header: "BLOCKED",
+			procFn: processBLOCKED,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "ignored",
+			header: "IGNORED",
+			procFn: processIGNORED,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "caught",
+			header: "CAUGHT",
+			procFn: processCAUGHT,
+			sources: process.SourceStatus,
+		},
+		{
+			normal: "pss",
+			header: "PSS",
+			procFn: processSmaps(smapsPss),
+			sources: process.SourceSmaps,
+			memory: true,
+		},
+		{
+			normal: "uss",
+			header: "USS",
+			procFn: processSmaps(smapsUss),
+			sources: process.SourceSmaps,
+			memory: true,
+		},
+		{
+			normal: "swap",
+			header: "SWAP",
+			procFn: processSmaps(smapsSwap),
+			sources: process.SourceSmaps,
+			memory: true,
+		},
+		{
+			normal: "swappss",
+			header: "SWAPPSS",
+			procFn: processSmaps(smapsSwapPss),
+			sources: process.SourceSmaps,
+			memory: true,
+		},
+		{
+			normal: "anonhuge",
+			header: "ANONHUGE",
+			procFn: processSmaps(smapsAnonHuge),
+			sources: process.SourceSmaps,
+			memory: true,
+		},
+		{
+			normal: "shared_clean",
+			header: "SHARED_CLEAN",
+			procFn: processSmaps(smapsSharedClean),
+			sources: process.SourceSmaps,
+			memory: true,
+		},
+		{
+			normal: "private_dirty",
+			header: "PRIVATE_DIRTY",
+			procFn: processSmaps(smapsPrivateDirty),
+			sources: process.SourceSmaps,
+			memory: true,
+		},
+		{
+			normal: "vmpeak",
+			header: "VMPEAK",
+			procFn: processStatusMemory(statusVMPeak),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmhwm",
+			header: "VMHWM",
+			procFn: processStatusMemory(statusVMHWM),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmdata",
+			header: "VMDATA",
+			procFn: processStatusMemory(statusVMData),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmstk",
+			header: "VMSTK",
+			procFn: processStatusMemory(statusVMStk),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmexe",
+			header: "VMEXE",
+			procFn: processStatusMemory(statusVMExe),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmlib",
+			header: "VMLIB",
+			procFn: processStatusMemory(statusVMLib),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmpte",
+			header: "VMPTE",
+			procFn: processStatusMemory(statusVMPTE),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmswap",
+			header: "VMSWAP",
+			procFn: processStatusMemory(statusVMSwap),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmlck",
+			header: "VMLCK",
+			procFn: processStatusMemory(statusVMLCK),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "vmpin",
+			header: "VMPIN",
+			procFn: processStatusMemory(statusVMPin),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "rssanon",
+			header: "RSSANON",
+			procFn: processStatusMemory(statusRssAnon),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "rssfile",
+			header: "RSSFILE",
+			procFn: processStatusMemory(statusRssFile),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "rssshmem",
+			header: "RSSSHMEM",
+			procFn: processStatusMemory(statusRssShmem),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "hugetlb",
+			header: "HUGETLB",
+			procFn: processStatusMemory(statusHugetlbPages),
+			sources: process.SourceStatus,
+			memory: true,
+		},
+		{
+			normal: "cgroup",
+			header: "CGROUP",
+			procFn: processCGROUP,
+			sources: process.SourceCgroup,
+		},
+		{
+			normal: "container_id",
+			header: "CONTAINER",
+			procFn: processCONTAINERID,
+			sources: process.SourceCgroup,
+			format: formatContainerID,
+		},
+		{
+			normal: "container_runtime",
+			header: "RUNTIME",
+			procFn: processCONTAINERRUNTIME,
+			sources: process.SourceCgroup,
+			format: formatEmptyDash,
+		},
+		{
+			normal: "memory_current",
+			header: "MEMCUR",
+			procFn: processCgroupMemoryCurrent,
+			sources: process.SourceCgroup,
+			memory: true,
+		},
+		{
+			normal: "memory_max",
+			header: "MEMMAX",
+			procFn: processCgroupMemoryMax,
+			sources: process.SourceCgroup,
+			memory: true,
+		},
+		{
+			normal: "oom_kill",
+			header: "OOMKILL",
+			procFn: processCgroupOOMKill,
+			kind: kindNumber,
+			sources: process.SourceCgroup,
+		},
+		{
+			normal: "cpu_max",
+			header: "CPUMAX",
+			procFn: processCgroupCPUMax,
+			kind: kindNumber,
+			sources: process.SourceCgroup,
+			format: formatCPUs,
+		},
+		{
+			normal: "nr_periods",
+			header: "PERIODS",
+			procFn: processCgroupNrPeriods,
+			kind: kindNumber,
+			sources: process.SourceCgroup,
+		},
+		{
+			normal: "nr_throttled",
+			header: "THROTTLED",
+			procFn: processCgroupNrThrottled,
+			kind: kindNumber,
+			sources: process.SourceCgroup,
+		},
+		{
+			normal: "throttled_time",
+			header: "THROTTLEDTIME",
+			procFn: processCgroupThrottledTime,
+			kind: kindDuration,
+			sources: process.SourceCgroup,
+		},
+		{
+			normal: "pids_current",
+			header: "PIDSCUR",
+			procFn: processCgroupPidsCurrent,
+			kind: kindNumber,
+			sources: process.SourceCgroup,
+		},
+		{
+			normal: "pids_max",
+			header: "PIDSMAX",
+			procFn: processCgroupPidsMax,
+			kind: kindNumber,
+			sources: process.SourceCgroup,
+			format: formatMax,
+		},
+		{
+			normal: "pidns",
+			header: "PIDNS",
+			procFn: processNamespace("pid"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
+		},
+		{
+			normal: "mntns",
+			header: "MNTNS",
+			procFn: processNamespace("mnt"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
+		},
+		{
+			normal: "netns",
+			header: "NETNS",
+			procFn: processNamespace("net"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
+		},
+		{
+			normal: "ipcns",
+			header: "IPCNS",
+			procFn: processNamespace("ipc"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
+		},
+		{
+			normal: "utsns",
+			header: "UTSNS",
+			procFn: processNamespace("uts"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
+		},
+		{
+			normal: "userns",
+			header: "USERNS",
+			procFn: processNamespace("user"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
+		},
+		{
+			normal: "cgroupns",
+			header: "CGROUPNS",
+			procFn: processNamespace("cgroup"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
+		},
+		{
+			normal: "timens",
+			header: "TIMENS",
+			procFn: processNamespace("time"),
+			kind: kindNumber,
+			sources: process.SourceNamespaces,
 		},
 	}
 )
 
 func ListDescriptors() (list []string) {
+	descriptorsMu.RLock()
+	defer descriptorsMu.RUnlock()
+
 	for _, d := range aixFormatDescriptors {
 		list = append(list, d.normal)
 	}
+	for name := range procpsAliases {
+		list = append(list, name)
+	}
 
 	sort.Strings(list)
 	return
 }
 
+// DescriptorNames translates the specified AIX codes or descriptor names to
+// the names used as keys in a Row.  DefaultDescriptors are used if
+// descriptors is empty.
+func DescriptorNames(descriptors []string) ([]string, error) {
+	aixDescriptors, err := translateDescriptors(descriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, d := range aixDescriptors {
+		names = append(names, d.normal)
+	}
+
+	return names, nil
+}
+
+// RenderRows renders typed rows as returned by ProcessRows and friends to the
+// same table of strings ProcessInfo returns, with the descriptors' headers as
+// the first row.
+func RenderRows(descriptors []string, rows []Row) ([][]string, error) {
+	return RenderRowsAt(descriptors, rows, time.Now())
+}
+
+// RenderRowsAt is like RenderRows but renders times such as "stime" relative
+// to now, which is the Time of the Archive for captured processes.
+func RenderRowsAt(descriptors []string, rows []Row, now time.Time) ([][]string, error) {
+	aixDescriptors, err := translateDescriptors(descriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderRows(aixDescriptors, rows, now), nil
+}
+
+// listing describes a single process listing: the descriptors requested by
+// the caller and the options applied to the extracted rows.
+type listing struct {
+	// ctx bounds the extraction of the processes.
+	ctx context.Context
+	// descriptors are the descriptors requested by the caller.
+	descriptors []aixFormatDescriptor
+	// extract are the descriptors to extract from each process, i.e., the
+	// requested ones plus those the options depend on.
+	extract []aixFormatDescriptor
+	sortKeys []sortKey
+	filter *Filter
+	tree TreeStyle
+	sampler *Sampler
+	threads bool
+	concurrency int
+	// sources are the files to parse for each process.
+	sources process.Source
+	// fsys is the file system to read the processes from.
+	fsys procfs.FS
+}
+
+func newListing(ctx context.Context, descriptors []string, options *ProcessInfoOpts) (*listing, error) {
+	aixDescriptors, err := translateDescriptors(descriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &listing{ctx: ctx, descriptors: aixDescriptors, extract: aixDescriptors, concurrency: runtime.NumCPU(), fsys: options.fs()}
+	for _, d := range aixDescriptors {
+		l.sources |= d.sources
+	}
+	if options == nil {
+		return l, nil
+	}
+
+	l.sortKeys, err = translateSortKeys(options.SortKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range l.sortKeys {
+		l.require(k.desc)
+	}
+
+	l.tree = options.Tree
+	if l.tree != TreeNone {
+		treeDescriptors, err := translateDescriptors([]string{"pid", "ppid"})
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range treeDescriptors {
+			l.require(d)
+		}
+	}
+
+	l.threads = options.Threads
+	if options.Concurrency > 0 {
+		l.concurrency = options.Concurrency
+	}
+	l.sampler = options.Sampler
+	if l.sampler != nil {
+		if err := l.sampler.begin(l.fsys); err != nil {
+			return nil, err
+		}
+		// samples are keyed by the pid namespace
+		l.sources |= process.SourcePIDNamespace
+	}
+
+	l.filter = options.Filter
+	if l.filter != nil {
+		for _, d := range l.filter.descs {
+			l.require(d)
+		}
+	}
+
+	return l, nil
+}
+
+// require adds d to the descriptors to extract unless already present.
+func (l *listing) require(d aixFormatDescriptor) {
+	l.sources |= d.sources
+
+	for _, e := range l.extract {
+		if e.normal == d.normal {
+			return
+		}
+	}
+
+	// copy to not modify the requested descriptors
+	l.extract = append(l.extract[:len(l.extract):len(l.extract)], d)
+}
+
+// finish applies the options on the rows of one or more pid namespaces and
+// strips all values that were only extracted for the options.  Rows are
+// sorted across all namespaces, unless a tree is requested, in which case
+// each namespace forms its own forest.
+func (l *listing) finish(groups ...[]Row) []Row {
+	rows := []Row{}
+	if l.tree != TreeNone {
+		for _, group := range groups {
+			sortRows(group, l.sortKeys)
+			rows = append(rows, arrangeTree(group, l.tree)...)
+		}
+	} else {
+		for _, group := range groups {
+			rows = append(rows, group...)
+		}
+		sortRows(rows, l.sortKeys)
+	}
+
+	if len(l.extract) == len(l.descriptors) {
+		return rows
+	}
+
+	for _, row := range rows {
+		for _, d := range l.extract[len(l.descriptors):] {
+			delete(row, d.normal)
+		}
+	}
+
+	return rows
+}
+
+// processes creates a new Process for each of pids or, when listing threads,
+// for each of their threads.  Processes are parsed in parallel unless joined
+// is set, which must be the case when called from the thread that joined a
+// mount namespace.
+func (l *listing) processes(pids []string, joined, joinUserNS bool) ([]*process.Process, error) {
+	opts := process.Options{JoinUserNS: joinUserNS, Concurrency: l.concurrency, Sources: l.sources, FS: l.fsys}
+	if joined {
+		opts.Concurrency = 1
+		opts.FS = procfs.Host
+	}
+
+	if l.threads {
+		return process.TasksFromPIDs(l.ctx, pids, opts)
+	}
+
+	return process.FromPIDs(l.ctx, pids, opts)
+}
+
+// timeoutError converts err into a *TimeoutError if the context of l is done.
+func (l *listing) timeoutError(err error) error {
+	if err != nil && l.ctx.Err() != nil {
+		return &TimeoutError{Err: l.ctx.Err()}
+	}
+
+	return err
+}
+
+// isTimeout returns true if err is a *TimeoutError.
+func isTimeout(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
+// render returns the finished rows as a table of strings.
+func (l *listing) render(groups ...[]Row) [][]string {
+	return renderRows(l.descriptors, l.finish(groups...), procfs.Now(l.fsys))
+}
+
 func readMappings(path string) ([]IDMap, error) {
-	mappings, err := proc.ReadMappings(path)
+	// the mappings of the caller are always read from the live system
+	mappings, err := proc.ReadMappings(procfs.Host, path)
 	if err != nil {
 		return nil, err
 	}
@@ -291,8 +1390,9 @@ func readMappings(path string) ([]IDMap, error) {
 	return res, nil
 }
 
-func contextFromOptions(options *JoinNamespaceOpts) (*psContext, error) {
+func contextFromOptions(fsys procfs.FS, options *JoinNamespaceOpts) (*psContext, error) {
 	ctx := new(psContext)
+	ctx.fsys = fsys
 	ctx.opts = options
 	if ctx.opts != nil && ctx.opts.FillMappings {
 		uidMappings, err := readMappings("/proc/self/uid_map")
@@ -313,107 +1413,149 @@ func contextFromOptions(options *JoinNamespaceOpts) (*psContext, error) {
 	return ctx, nil
 }
 
-func JoinNamespaceAndProcessInfoWithOptions(pid string, descriptors []string, options *JoinNamespaceOpts) ([][]string, error) {
+// TimeoutError is returned by the ...Context functions along with the
+// partial results extracted so far when their context is cancelled or its
+// deadline is exceeded.
+type TimeoutError struct {
+	// Err is the error of the context (i.e., context.Canceled or
+	// context.DeadlineExceeded).
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("incomplete process listing: %v", e.Err)
+}
+
+// Unwrap returns the error of the context.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the error of the context.
+func (e *TimeoutError) Cause() error {
+	return e.Err
+}
+
+// Timeout returns true if the deadline of the context was exceeded.
+func (e *TimeoutError) Timeout() bool {
+	return e.Err == context.DeadlineExceeded
+}
+
+// runOnLockedThread runs fn in a new goroutine locked to its OS thread and
+// waits until fn returns.  The thread may be left in the namespaces joined
+// by fn, which is why it's never unlocked and thus never reused.
+func runOnLockedThread(fn func() ([]Row, error)) ([]Row, error) {
 	var (
-		data    [][]string
-		dataErr error
-		wg      sync.WaitGroup
+		rows []Row
+		err  error
+		wg   sync.WaitGroup
 	)
 
-	aixDescriptors, err := translateDescriptors(descriptors)
-	if err != nil {
-		return nil, err
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runtime.LockOSThread()
+		rows, err = fn()
+	}()
+	wg.Wait()
+
+	return rows, err
+}
+
+// joinNamespaceAndProcessRows joins the mount namespace of pid and returns the
+// typed values of the specified descriptors for all processes in it.
+func joinNamespaceAndProcessRows(pid string, l *listing, options *JoinNamespaceOpts) ([]Row, error) {
+	// joining the mount namespace needs a file descriptor and thus a live
+	// /proc
+	root, ok := l.fsys.(procfs.Root)
+	if !ok {
+		return nil, errors.New("cannot join the namespaces of archived processes")
 	}
 
-	ctx, err := contextFromOptions(options)
+	// the processes are read from the /proc of the joined mount namespace
+	ctx, err := contextFromOptions(procfs.Host, options)
 	if err != nil {
 		return nil, err
 	}
+	ctx.sampler = l.sampler
 
 	// extract data from host processes only on-demand / when at least one
 	// of the specified descriptors requires host data
-	for _, d := range aixDescriptors {
+	for _, d := range l.extract {
 		if d.onHost {
-			ctx.hostProcesses, err = hostProcesses(pid)
+			ctx.hostProcesses, err = hostProcesses(l.ctx, l.fsys, pid, l.concurrency)
 			if err != nil {
 				return nil, err
 			}
 			break
-		}
-	}
-
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		runtime.LockOSThread()
+		}
+	}
 
+	return runOnLockedThread(func() ([]Row, error) {
 		// extract user namespaces prior to joining the mount namespace
-		currentUserNs, err := proc.ParseUserNamespace("self")
+		currentUserNs, err := proc.ParseUserNamespace(procfs.Host, "self")
 		if err != nil {
-			dataErr = errors.Wrapf(err, "error determining user namespace")
-			return
+			return nil, errors.Wrapf(err, "error determining user namespace")
 		}
 
-		pidUserNs, err := proc.ParseUserNamespace(pid)
+		pidUserNs, err := proc.ParseUserNamespace(l.fsys, pid)
 		if err != nil {
-			dataErr = errors.Wrapf(err, "error determining user namespace of PID %s", pid)
+			return nil, errors.Wrapf(err, "error determining user namespace of PID %s", pid)
 		}
 
 		// join the mount namespace of pid
-		fd, err := os.Open(fmt.Sprintf("/proc/%s/ns/mnt", pid))
+		fd, err := os.Open(root.Path(fmt.Sprintf("/proc/%s/ns/mnt", pid)))
 		if err != nil {
-			dataErr = err
-			return
+			return nil, err
 		}
 	
 		defer fd.Close()
 
 		// create a new mountns on the current thread
 		if err = unix.Unshare(unix.CLONE_NEWNS); err != nil {
-			dataErr = err
-			return
+			return nil, err
 		}
 
 		if err := unix.Setns(int(fd.Fd()), unix.CLONE_NEWNS); err != nil {
-			dataErr = err
-			return
+			return nil, err
 		}
 
 		// extract all pids mentioned in pid's mount namespace
-		pids, err := proc.GetPIDs()
+		pids, err := proc.GetPIDs(procfs.Host)
 		if err != nil {
-			dataErr = err
-			return
+			return nil, err
 		}
 
 		// join the user NS if the pid's user NS is different
 		// to the caller's user NS.
 		joinUserNS := currentUserNs != pidUserNs
 
-		ctx.containersProcesses, err = process.FromPIDs(pids, joinUserNS)
-		if err != nil {
-			dataErr = err
-			return
+		var processesErr error
+		ctx.containersProcesses, processesErr = l.processes(pids, true, joinUserNS)
+		if processesErr != nil && l.ctx.Err() == nil {
+			return nil, processesErr
 		}
 
-		data, dataErr = processDescriptors(aixDescriptors, ctx)
-	}()
-
-	wg.Wait()
-
-	return data, dataErr
-}
+		rows, err := processValues(l, ctx)
+		if err != nil && !isTimeout(err) {
+			return nil, err
+		}
+		if processesErr != nil {
+			err = processesErr
+		}
 
-func JoinNamespaceAndProcessInfo(pid string, descriptors []string) ([][]string, error) {
-	return JoinNamespaceAndProcessInfoWithOptions(pid, descriptors, &JoinNamespaceOpts{})
+		return rows, err
+	})
 }
 
-func JoinNamespaceAndProcessInfoByPidsWithOptions(pids []string, descriptors []string, options *JoinNamespaceOpts) ([][]string, error) {
+// joinNamespaceAndProcessRowsByPids returns the typed values of the specified
+// descriptors for all processes in the pid namespaces of pids, grouped by
+// namespace.  Each pid namespace is joined only once.
+func joinNamespaceAndProcessRowsByPids(pids []string, l *listing, options *JoinNamespaceOpts) ([][]Row, error) {
 	nsMap := make(map[string]bool)
 	pidList := []string{}
 	for _, pid := range pids {
-		ns, err := proc.ParsePIDNamespace(pid)
+		ns, err := proc.ParsePIDNamespace(l.fsys, pid)
 		if err != nil {
 			if os.IsNotExist(errors.Cause(err)) {
 				continue
@@ -428,68 +1570,328 @@ func JoinNamespaceAndProcessInfoByPidsWithOptions(pids []string, descriptors []s
 		}
 	}
 
-	data := [][]string{}
-	for i, pid := range pidList {
-		pidData, err := JoinNamespaceAndProcessInfoWithOptions(pid, descriptors, options)
+	groups := [][]Row{}
+	for _, pid := range pidList {
+		if err := l.ctx.Err(); err != nil {
+			return groups, err
+		}
+
+		pidRows, err := joinNamespaceAndProcessRows(pid, l, options)
 		if os.IsNotExist(errors.Cause(err)) {
 			continue
 		}
 
 		if err != nil {
+			if l.ctx.Err() != nil {
+				return append(groups, pidRows), err
+			}
+
 			return nil, err
 		}
 
-		if i == 0 {
-			data = append(data, pidData[0])
-		}
+		groups = append(groups, pidRows)
+	}
+
+	return groups, nil
+}
+
+// processRowsByPids returns the typed values of the specified descriptors for
+// the processes with the specified pids.
+func processRowsByPids(pids []string, l *listing) ([]Row, error) {
+	ctx, err := contextFromOptions(l.fsys, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx.sampler = l.sampler
+
+	var processesErr error
+	ctx.containersProcesses, processesErr = l.processes(pids, false, false)
+	if processesErr != nil && l.ctx.Err() == nil {
+		return nil, processesErr
+	}
+
+	rows, err := processValues(l, ctx)
+	if err != nil && !isTimeout(err) {
+		return nil, err
+	}
+	if processesErr != nil {
+		err = processesErr
+	}
+
+	return rows, err
+}
+
+// joinOptions returns the ProcessInfoOpts embedded in options.
+func joinOptions(options *JoinNamespaceOpts) *ProcessInfoOpts {
+	if options == nil {
+		return nil
+	}
+
+	return &options.ProcessInfoOpts
+}
+
+func JoinNamespaceAndProcessInfoWithOptions(pid string, descriptors []string, options *JoinNamespaceOpts) ([][]string, error) {
+	return JoinNamespaceAndProcessInfoWithOptionsContext(context.Background(), pid, descriptors, options)
+}
+
+// JoinNamespaceAndProcessInfoWithOptionsContext is
+// JoinNamespaceAndProcessInfoWithOptions honouring the deadline and
+// cancellation of ctx.  Once ctx is done, it returns the processes extracted
+// so far along with a *TimeoutError.
+func JoinNamespaceAndProcessInfoWithOptionsContext(ctx context.Context, pid string, descriptors []string, options *JoinNamespaceOpts) ([][]string, error) {
+	l, err := newListing(ctx, descriptors, joinOptions(options))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := joinNamespaceAndProcessRows(pid, l, options)
+	if err = l.timeoutError(err); err != nil && !isTimeout(err) {
+		return nil, err
+	}
+
+	return l.render(rows), err
+}
+
+func JoinNamespaceAndProcessInfo(pid string, descriptors []string) ([][]string, error) {
+	return JoinNamespaceAndProcessInfoContext(context.Background(), pid, descriptors)
+}
+
+// JoinNamespaceAndProcessInfoContext is JoinNamespaceAndProcessInfo honouring
+// the deadline and cancellation of ctx.
+func JoinNamespaceAndProcessInfoContext(ctx context.Context, pid string, descriptors []string) ([][]string, error) {
+	return JoinNamespaceAndProcessInfoWithOptionsContext(ctx, pid, descriptors, &JoinNamespaceOpts{})
+}
+
+func JoinNamespaceAndProcessInfoByPidsWithOptions(pids []string, descriptors []string, options *JoinNamespaceOpts) ([][]string, error) {
+	return JoinNamespaceAndProcessInfoByPidsWithOptionsContext(context.Background(), pids, descriptors, options)
+}
+
+// JoinNamespaceAndProcessInfoByPidsWithOptionsContext is
+// JoinNamespaceAndProcessInfoByPidsWithOptions honouring the deadline and
+// cancellation of ctx.  Once ctx is done, it returns the processes extracted
+// so far along with a *TimeoutError.
+func JoinNamespaceAndProcessInfoByPidsWithOptionsContext(ctx context.Context, pids []string, descriptors []string, options *JoinNamespaceOpts) ([][]string, error) {
+	l, err := newListing(ctx, descriptors, joinOptions(options))
+	if err != nil {
+		return nil, err
+	}
 
-		data = append(data, pidData[1:]...)
+	groups, err := joinNamespaceAndProcessRowsByPids(pids, l, options)
+	if err = l.timeoutError(err); err != nil && !isTimeout(err) {
+		return nil, err
 	}
 
-	return data, nil
+	return l.render(groups...), err
 }
 
 func JoinNamespaceAndProcessInfoByPids(pids []string, descriptors []string) ([][]string, error) {
-	return JoinNamespaceAndProcessInfoByPidsWithOptions(pids, descriptors, &JoinNamespaceOpts{})
+	return JoinNamespaceAndProcessInfoByPidsContext(context.Background(), pids, descriptors)
+}
+
+// JoinNamespaceAndProcessInfoByPidsContext is
+// JoinNamespaceAndProcessInfoByPids honouring the deadline and cancellation of
+// ctx.
+func JoinNamespaceAndProcessInfoByPidsContext(ctx context.Context, pids []string, descriptors []string) ([][]string, error) {
+	return JoinNamespaceAndProcessInfoByPidsWithOptionsContext(ctx, pids, descriptors, &JoinNamespaceOpts{})
 }
 
 func ProcessInfo(descriptors []string) ([][]string, error) {
-	pids, err := proc.GetPIDs()
+	return ProcessInfoContext(context.Background(), descriptors)
+}
+
+// ProcessInfoContext is ProcessInfo honouring the deadline and cancellation
+// of ctx.
+func ProcessInfoContext(ctx context.Context, descriptors []string) ([][]string, error) {
+	return ProcessInfoWithOptionsContext(ctx, descriptors, nil)
+}
+
+// ProcessInfoWithOptions is ProcessInfo with additional options.
+func ProcessInfoWithOptions(descriptors []string, options *ProcessInfoOpts) ([][]string, error) {
+	return ProcessInfoWithOptionsContext(context.Background(), descriptors, options)
+}
+
+// ProcessInfoWithOptionsContext is ProcessInfoWithOptions honouring the
+// deadline and cancellation of ctx.
+func ProcessInfoWithOptionsContext(ctx context.Context, descriptors []string, options *ProcessInfoOpts) ([][]string, error) {
+	pids, err := proc.GetPIDs(options.fs())
 	if err != nil {
 		return nil, err
 	}
 
-	return ProcessInfoByPids(pids, descriptors)
+	return ProcessInfoByPidsWithOptionsContext(ctx, pids, descriptors, options)
 }
 
 func ProcessInfoByPids(pids []string, descriptors []string) ([][]string, error) {
-	aixDescriptors, err := translateDescriptors(descriptors)
+	return ProcessInfoByPidsContext(context.Background(), pids, descriptors)
+}
+
+// ProcessInfoByPidsContext is ProcessInfoByPids honouring the deadline and
+// cancellation of ctx.
+func ProcessInfoByPidsContext(ctx context.Context, pids []string, descriptors []string) ([][]string, error) {
+	return ProcessInfoByPidsWithOptionsContext(ctx, pids, descriptors, nil)
+}
+
+// ProcessInfoByPidsWithOptions is ProcessInfoByPids with additional options.
+func ProcessInfoByPidsWithOptions(pids []string, descriptors []string, options *ProcessInfoOpts) ([][]string, error) {
+	return ProcessInfoByPidsWithOptionsContext(context.Background(), pids, descriptors, options)
+}
+
+// ProcessInfoByPidsWithOptionsContext is ProcessInfoByPidsWithOptions
+// honouring the deadline and cancellation of ctx.  Once ctx is done, it
+// returns the processes extracted so far along with a *TimeoutError.
+func ProcessInfoByPidsWithOptionsContext(ctx context.Context, pids []string, descriptors []string, options *ProcessInfoOpts) ([][]string, error) {
+	l, err := newListing(ctx, descriptors, options)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := processRowsByPids(pids, l)
+	if err = l.timeoutError(err); err != nil && !isTimeout(err) {
+		return nil, err
+	}
+
+	return l.render(rows), err
+}
+
+// JoinNamespaceAndProcessRowsWithOptions is the typed counterpart of
+// JoinNamespaceAndProcessInfoWithOptions.
+func JoinNamespaceAndProcessRowsWithOptions(pid string, descriptors []string, options *JoinNamespaceOpts) ([]Row, error) {
+	return JoinNamespaceAndProcessRowsWithOptionsContext(context.Background(), pid, descriptors, options)
+}
+
+// JoinNamespaceAndProcessRowsWithOptionsContext is the typed counterpart of
+// JoinNamespaceAndProcessInfoWithOptionsContext.
+func JoinNamespaceAndProcessRowsWithOptionsContext(ctx context.Context, pid string, descriptors []string, options *JoinNamespaceOpts) ([]Row, error) {
+	l, err := newListing(ctx, descriptors, joinOptions(options))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := joinNamespaceAndProcessRows(pid, l, options)
+	if err = l.timeoutError(err); err != nil && !isTimeout(err) {
+		return nil, err
+	}
+
+	return l.finish(rows), err
+}
+
+// JoinNamespaceAndProcessRows is the typed counterpart of
+// JoinNamespaceAndProcessInfo.
+func JoinNamespaceAndProcessRows(pid string, descriptors []string) ([]Row, error) {
+	return JoinNamespaceAndProcessRowsContext(context.Background(), pid, descriptors)
+}
+
+// JoinNamespaceAndProcessRowsContext is the typed counterpart of
+// JoinNamespaceAndProcessInfoContext.
+func JoinNamespaceAndProcessRowsContext(ctx context.Context, pid string, descriptors []string) ([]Row, error) {
+	return JoinNamespaceAndProcessRowsWithOptionsContext(ctx, pid, descriptors, &JoinNamespaceOpts{})
+}
+
+// JoinNamespaceAndProcessRowsByPidsWithOptions is the typed counterpart of
+// JoinNamespaceAndProcessInfoByPidsWithOptions.
+func JoinNamespaceAndProcessRowsByPidsWithOptions(pids []string, descriptors []string, options *JoinNamespaceOpts) ([]Row, error) {
+	return JoinNamespaceAndProcessRowsByPidsWithOptionsContext(context.Background(), pids, descriptors, options)
+}
+
+// JoinNamespaceAndProcessRowsByPidsWithOptionsContext is the typed counterpart
+// of JoinNamespaceAndProcessInfoByPidsWithOptionsContext.
+func JoinNamespaceAndProcessRowsByPidsWithOptionsContext(ctx context.Context, pids []string, descriptors []string, options *JoinNamespaceOpts) ([]Row, error) {
+	l, err := newListing(ctx, descriptors, joinOptions(options))
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, err := contextFromOptions(nil)
+	groups, err := joinNamespaceAndProcessRowsByPids(pids, l, options)
+	if err = l.timeoutError(err); err != nil && !isTimeout(err) {
+		return nil, err
+	}
+
+	return l.finish(groups...), err
+}
+
+// JoinNamespaceAndProcessRowsByPids is the typed counterpart of
+// JoinNamespaceAndProcessInfoByPids.
+func JoinNamespaceAndProcessRowsByPids(pids []string, descriptors []string) ([]Row, error) {
+	return JoinNamespaceAndProcessRowsByPidsContext(context.Background(), pids, descriptors)
+}
+
+// JoinNamespaceAndProcessRowsByPidsContext is the typed counterpart of
+// JoinNamespaceAndProcessInfoByPidsContext.
+func JoinNamespaceAndProcessRowsByPidsContext(ctx context.Context, pids []string, descriptors []string) ([]Row, error) {
+	return JoinNamespaceAndProcessRowsByPidsWithOptionsContext(ctx, pids, descriptors, &JoinNamespaceOpts{})
+}
+
+// ProcessRows is the typed counterpart of ProcessInfo.
+func ProcessRows(descriptors []string) ([]Row, error) {
+	return ProcessRowsContext(context.Background(), descriptors)
+}
+
+// ProcessRowsContext is the typed counterpart of ProcessInfoContext.
+func ProcessRowsContext(ctx context.Context, descriptors []string) ([]Row, error) {
+	return ProcessRowsWithOptionsContext(ctx, descriptors, nil)
+}
+
+// ProcessRowsWithOptions is the typed counterpart of ProcessInfoWithOptions.
+func ProcessRowsWithOptions(descriptors []string, options *ProcessInfoOpts) ([]Row, error) {
+	return ProcessRowsWithOptionsContext(context.Background(), descriptors, options)
+}
+
+// ProcessRowsWithOptionsContext is the typed counterpart of
+// ProcessInfoWithOptionsContext.
+func ProcessRowsWithOptionsContext(ctx context.Context, descriptors []string, options *ProcessInfoOpts) ([]Row, error) {
+	pids, err := proc.GetPIDs(options.fs())
 	if err != nil {
 		return nil, err
 	}
 
-	ctx.containersProcesses, err = process.FromPIDs(pids, false)
+	return ProcessRowsByPidsWithOptionsContext(ctx, pids, descriptors, options)
+}
+
+// ProcessRowsByPids is the typed counterpart of ProcessInfoByPids.
+func ProcessRowsByPids(pids []string, descriptors []string) ([]Row, error) {
+	return ProcessRowsByPidsContext(context.Background(), pids, descriptors)
+}
+
+// ProcessRowsByPidsContext is the typed counterpart of
+// ProcessInfoByPidsContext.
+func ProcessRowsByPidsContext(ctx context.Context, pids []string, descriptors []string) ([]Row, error) {
+	return ProcessRowsByPidsWithOptionsContext(ctx, pids, descriptors, nil)
+}
+
+// ProcessRowsByPidsWithOptions is the typed counterpart of
+// ProcessInfoByPidsWithOptions.
+func ProcessRowsByPidsWithOptions(pids []string, descriptors []string, options *ProcessInfoOpts) ([]Row, error) {
+	return ProcessRowsByPidsWithOptionsContext(context.Background(), pids, descriptors, options)
+}
+
+// ProcessRowsByPidsWithOptionsContext is the typed counterpart of
+// ProcessInfoByPidsWithOptionsContext.
+func ProcessRowsByPidsWithOptionsContext(ctx context.Context, pids []string, descriptors []string, options *ProcessInfoOpts) ([]Row, error) {
+	l, err := newListing(ctx, descriptors, options)
 	if err != nil {
 		return nil, err
 	}
 
-	return processDescriptors(aixDescriptors, ctx)
+	rows, err := processRowsByPids(pids, l)
+	if err = l.timeoutError(err); err != nil && !isTimeout(err) {
+		return nil, err
+	}
+
+	return l.finish(rows), err
 }
 
-// hostProcesses returns all processes running in the current namespace.
-func hostProcesses(pid string) ([]*process.Process, error) {
+// hostProcesses returns all processes running in the current namespace.  Up
+// to concurrency processes are parsed in parallel.
+func hostProcesses(ctx context.Context, fsys procfs.FS, pid string, concurrency int) ([]*process.Process, error) {
 	// get processes
-	pids, err := proc.GetPIDsFromCgroup(pid)
+	pids, err := proc.GetPIDsFromCgroup(fsys, pid)
 	if err != nil {
 		return nil, err
 	}
 
-	processes, err := process.FromPIDs(pids, false)
+	// host processes are matched by their pid namespace and NSpid and need
+	// the IDs in status
+	processes, err := process.FromPIDs(ctx, pids, process.Options{Concurrency: concurrency, Sources: process.SourceStatus | process.SourcePIDNamespace, FS: fsys})
 	if err != nil {
 		return nil, err
 	}
@@ -504,7 +1906,67 @@ func hostProcesses(pid string) ([]*process.Process, error) {
 	return processes, nil
 }
 
-func processDescriptors(formatDescriptors []aixFormatDescriptor, ctx *psContext) ([][]string, error) {
+// processValues dispatches all descriptor functions on each process and
+// returns one Row per process.  If l has a filter, the descriptors of the
+// filter are dispatched first and processes not matching it are skipped.
+// Once the context of l is done, the rows extracted so far are returned
+// along with a *TimeoutError.
+func processValues(l *listing, ctx *psContext) ([]Row, error) {
+	// the processes parsed before the context was done are still listed
+	expired := l.ctx.Err() != nil
+	now := procfs.Now(l.fsys)
+	ctx.parseCtx = l.ctx
+
+	rows := []Row{}
+	for _, proc := range ctx.containersProcesses {
+		if err := l.ctx.Err(); err != nil && !expired {
+			return rows, &TimeoutError{Err: err}
+		}
+
+		if ctx.sampler != nil {
+			if err := ctx.sampler.observe(proc, l.fsys); err != nil {
+				return nil, err
+			}
+		}
+
+		row := make(Row, len(l.extract))
+		if l.filter != nil {
+			for _, desc := range l.filter.descs {
+				value, err := desc.procFn(proc, ctx)
+				if err != nil {
+					return nil, err
+				}
+				row[desc.normal] = value
+			}
+
+			match, err := l.filter.matchAt(row, now)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+		}
+
+		for _, desc := range l.extract {
+			if _, done := row[desc.normal]; done {
+				continue
+			}
+			value, err := desc.procFn(proc, ctx)
+			if err != nil {
+				return nil, err
+			}
+			row[desc.normal] = value
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// renderRows renders rows listed at now as a table of strings with the
+// descriptors' headers as the first row.
+func renderRows(formatDescriptors []aixFormatDescriptor, rows []Row, now time.Time) [][]string {
 	data := [][]string{}
 	// create header
 	header := []string{}
@@ -513,20 +1975,124 @@ func processDescriptors(formatDescriptors []aixFormatDescriptor, ctx *psContext)
 	}
 	data = append(data, header)
 
-	// dispatch all descriptor functions on each process
-	for _, proc := range ctx.containersProcesses {
+	for _, row := range rows {
 		pData := []string{}
 		for _, desc := range formatDescriptors {
-			dataStr, err := desc.procFn(proc, ctx)
-			if err != nil {
-				return nil, err
-			}
-			pData = append(pData, dataStr)
+			pData = append(pData, desc.renderIn(row[desc.normal], UnitKiB, now))
 		}
 		data = append(data, pData)
 	}
 
-	return data, nil
+	return data
+}
+
+// renderIn returns the string representation of value with memory rendered
+// in unit and times such as "stime" relative to now.
+func (d *aixFormatDescriptor) renderIn(value interface{}, unit Unit, now time.Time) string {
+	if d.formatAt != nil {
+		return d.formatAt(value, now)
+	}
+
+	if d.format != nil {
+		return d.format(value)
+	}
+
+	if d.memory {
+		return formatMemory(value, unit)
+	}
+
+	return formatValue(value)
+}
+
+// formatValue is the default formatFunc.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+		case nil:
+			return "?"
+		case string:
+			return v
+		case int:
+			return strconv.Itoa(v)
+		case uint64:
+			return strconv.FormatUint(v, 10)
+		case float64:
+			return strconv.FormatFloat(v, 'f', 3, 64)
+		default:
+			return fmt.Sprintf("%v", v)
+	}
+}
+
+// formatElapsed renders a duration as [[dd-]hh:]mm:ss like the etime of
+// procps-ng.
+func formatElapsed(value interface{}) string {
+	d, ok := value.(time.Duration)
+	if !ok {
+		return formatValue(value)
+	}
+
+	days, hours, mins, secs := splitDuration(d)
+	switch {
+		case days > 0:
+			return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, mins, secs)
+		case hours > 0:
+			return fmt.Sprintf("%02d:%02d:%02d", hours, mins, secs)
+		default:
+			return fmt.Sprintf("%02d:%02d", mins, secs)
+	}
+}
+
+// formatCPUTime renders a duration as [dd-]hh:mm:ss like the time of
+// procps-ng.
+func formatCPUTime(value interface{}) string {
+	d, ok := value.(time.Duration)
+	if !ok {
+		return formatValue(value)
+	}
+
+	days, hours, mins, secs := splitDuration(d)
+	if days > 0 {
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, mins, secs)
+	}
+
+	return fmt.Sprintf("%02d:%02d:%02d", hours, mins, secs)
+}
+
+// splitDuration splits d into whole days, hours, minutes and seconds.
+func splitDuration(d time.Duration) (days, hours, mins, secs int64) {
+	total := int64(d / time.Second)
+	if total < 0 {
+		total = 0
+	}
+
+	return total / 86400, total / 3600 % 24, total / 60 % 60, total % 60
+}
+
+// formatStartTime renders a time like the stime of procps-ng, i.e., as
+// HH:MM if less than 24 hours before now, MonDD if in the year of now and as
+// year otherwise.
+func formatStartTime(value interface{}, now time.Time) string {
+	t, ok := value.(time.Time)
+	if !ok {
+		return formatValue(value)
+	}
+
+	switch {
+		case now.Sub(t) < 24*time.Hour:
+			return t.Format("15:04")
+		case now.Year() == t.Year():
+			return t.Format("Jan02")
+		default:
+			return t.Format("2006")
+	}
+}
+
+// formatLStart renders a time like the lstart of procps-ng.
+func formatLStart(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format("Mon Jan _2 15:04:05 2006")
+	}
+
+	return formatValue(value)
 }
 
 func findHostProcess(p *process.Process, ctx *psContext) *process.Process {
@@ -543,28 +2109,28 @@ func findHostProcess(p *process.Process, ctx *psContext) *process.Process {
 	return nil
 }
 
-func processGROUP(p *process.Process, ctx *psContext) (string, error) {
-	return process.LookupGID(p.Status.Gids[1])
+func processGROUP(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupGID(ctx.fsys, p.Status.Gids[1])
 }
 
-func processUSER(p *process.Process, ctx *psContext) (string, error) {
-	return process.LookupUID(p.Status.Uids[1])
+func processUSER(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupUID(ctx.fsys, p.Status.Uids[1])
 }
 
 // processRUSER returns the effective user name of the process.  This will be
 // the textual user ID, if it can be optained, or a decimal representation
 // otherwise.
-func processRUSER(p *process.Process, ctx *psContext) (string, error) {
-	return process.LookupUID(p.Status.Uids[0])
+func processRUSER(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupUID(ctx.fsys, p.Status.Uids[0])
 }
 
 // processName returns the name of process p in the format "[$name]".
-func processName(p *process.Process, ctx *psContext) (string, error) {
-	return fmt.Sprintf("[%s]", p.Status.Name), nil
+func processName(p *process.Process, ctx *psContext) (interface{}, error) {
+	return fmt.Sprintf("[%s]", p.Stat.Comm), nil
 }
 
 // processARGS returns the command of p with all its arguments.
-func processARGS(p *process.Process, ctx *psContext) (string, error) {
+func processARGS(p *process.Process, ctx *psContext) (interface{}, error) {
 	if p.CmdLine[0] == "" {
 		return processName(p, ctx)
 	}
@@ -573,140 +2139,165 @@ func processARGS(p *process.Process, ctx *psContext) (string, error) {
 }
 
 // processCOMM returns the command name (i.e., executable name) of process p.
-func processCOMM(p *process.Process, ctx *psContext) (string, error) {
+func processCOMM(p *process.Process, ctx *psContext) (interface{}, error) {
 	return p.Stat.Comm, nil
 }
 
 // processNICE returns the nice value of process p.
-func processNICE(p *process.Process, ctx *psContext) (string, error) {
-	return p.Stat.Nice, nil
+func processNICE(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Nice)
 }
 
 // processPID returns the process ID of process p.
-func processPID(p *process.Process, ctx *psContext) (string, error) {
-	return p.Pid, nil
+func processPID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Pid)
 }
 
 // processPGID returns the process group ID of process p.
-func processPGID(p *process.Process, ctx *psContext) (string, error) {
-	return p.Stat.Pgrp, nil
+func processPGID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Pgrp)
 }
 
 // processPCPU returns how many percent of the CPU time process p uses as
-func processPCPU(p *process.Process, ctx *psContext) (string, error) {
+// average over its lifetime or, with a Sampler, since the previous listing.
+func processPCPU(p *process.Process, ctx *psContext) (interface{}, error) {
+	if ctx.sampler != nil {
+		if pcpu, ok := ctx.sampler.pcpu(p); ok {
+			return pcpu, nil
+		}
+	}
+
 	elapsed, err := p.ElapsedTime()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	cpu, err := p.CPUTime()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	pcpu := 100 * cpu.Seconds() / elapsed.Seconds()
-
-	return strconv.FormatFloat(pcpu, 'f', 3, 64), nil
+	return 100 * cpu.Seconds() / elapsed.Seconds(), nil
 }
 
 // processETIME returns the elapsed time since the process was started.
-func processETIME(p *process.Process, ctx *psContext) (string, error) {
+func processETIME(p *process.Process, ctx *psContext) (interface{}, error) {
 	elapsed, err := p.ElapsedTime()
 	if err != nil {
-		return "", nil
+		if unavailable(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	return fmt.Sprintf("%v", elapsed), nil
+	return elapsed, nil
+}
+
+// unavailable returns true if err tells that a file doesn't exist (e.g., of a
+// process that exited), which renders a value as unavailable instead of
+// failing the listing.
+func unavailable(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, unix.ESRCH)
 }
 
 // processTIME returns the cumulative CPU time of process p.
-func processTIME(p *process.Process, ctx *psContext) (string, error) {
+func processTIME(p *process.Process, ctx *psContext) (interface{}, error) {
+	cpu, err := p.CPUTime()
+	if err != nil {
+		return nil, err
+	}
+
+	return cpu, nil
+}
+
+// processETIMES returns the elapsed time since process p was started in
+// seconds.
+func processETIMES(p *process.Process, ctx *psContext) (interface{}, error) {
+	elapsed, err := p.ElapsedTime()
+	if err != nil {
+		return nil, err
+	}
+
+	return int(elapsed / time.Second), nil
+}
+
+// processTIMES returns the cumulative CPU time of process p in seconds.
+func processTIMES(p *process.Process, ctx *psContext) (interface{}, error) {
 	cpu, err := p.CPUTime()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return fmt.Sprintf("%v", cpu), nil
+	return int(cpu / time.Second), nil
 }
 
 // processStartTime returns the start time of process p.
-func processStartTime(p *process.Process, ctx *psContext) (string, error) {
+func processStartTime(p *process.Process, ctx *psContext) (interface{}, error) {
 	sTime, err := p.StartTime()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return fmt.Sprintf("%v", sTime), nil
+	return sTime, nil
 }
 
 // processTTY returns the controlling tty (terminal) of process p.
-func processTTY(p *process.Process, ctx *psContext) (string, error) {
+func processTTY(p *process.Process, ctx *psContext) (interface{}, error) {
 	ttyNr, err := strconv.ParseUint(p.Stat.TtyNr, 10, 64)
 	if err != nil {
-		return "", nil
+		return nil, errors.Wrap(err, "error parsing tty_nr")
 	}
 
-	tty, err := dev.FindTTY(ttyNr, ctx.ttys)
+	tty, err := dev.FindTTY(ctx.fsys, ttyNr, ctx.ttys)
 	if err != nil {
-		return "", nil
+		if unavailable(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	ttyS := "?"
-	if tty != nil {
-		ttyS = strings.TrimPrefix(tty.Path, "/dev/")
+	if tty == nil {
+		return nil, nil
 	}
 
-	return ttyS, nil
+	return strings.TrimPrefix(tty.Path, "/dev/"), nil
 }
 
-func processVSZ(p *process.Process, ctx *psContext) (string, error) {
-	vmsize, err := strconv.Atoi(p.Stat.Vsize)
-	if err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("%d", vmsize/1024), nil
+// processVSZ returns the virtual memory size of process p in bytes.
+func processVSZ(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.ParseUint(p.Stat.Vsize, 10, 64)
 }
 
-func parseCAP(cap string) (string, error) {
+func parseCAP(cap string) (interface{}, error) {
 	mask, err := strconv.ParseUint(cap, 16, 64)
 	if err != nil {
-		return "", err
-	}
-
-	if mask == capkg.FullCAPs {
-		return "full", nil
-	}
-
-	caps := capkg.TranslateMask(mask)
-	if len(caps) == 0 {
-		return "none", nil
+		return nil, err
 	}
 
-	sort.Strings(caps)
-	return strings.Join(caps, ","), nil
+	return CapSet(mask), nil
 }
 
-func processCAPAMB(p *process.Process, ctx *psContext) (string, error) {
+func processCAPAMB(p *process.Process, ctx *psContext) (interface{}, error) {
 	return parseCAP(p.Status.CapAmb)
 }
 
-func processCAPINH(p *process.Process, ctx *psContext) (string, error) {
+func processCAPINH(p *process.Process, ctx *psContext) (interface{}, error) {
 	return parseCAP(p.Status.CapInh)
 }
 
-func processCAPPRM(p *process.Process, ctx *psContext) (string, error) {
+func processCAPPRM(p *process.Process, ctx *psContext) (interface{}, error) {
 	return parseCAP(p.Status.CapPrm)
 }
 
-func processCAPEFF(p *process.Process, ctx *psContext) (string, error) {
+func processCAPEFF(p *process.Process, ctx *psContext) (interface{}, error) {
 	return parseCAP(p.Status.CapEff)
 }
 
-func processCAPBND(p *process.Process, ctx *psContext) (string, error) {
+func processCAPBND(p *process.Process, ctx *psContext) (interface{}, error) {
 	return parseCAP(p.Status.CapBnd)
 }
 
-func processSECCOMP(p *process.Process, ctx *psContext) (string, error) {
+func processSECCOMP(p *process.Process, ctx *psContext) (interface{}, error) {
 	switch p.Status.Seccomp {
 		case "0":
 			return "disabled", nil
@@ -715,65 +2306,83 @@ func processSECCOMP(p *process.Process, ctx *psContext) (string, error) {
 		case "2":
 			return "filter", nil
 		default:
-			return "?", nil
+			return nil, nil
 	}
 }
 
-func processLABEL(p *process.Process, ctx *psContext) (string, error) {
+func processLABEL(p *process.Process, ctx *psContext) (interface{}, error) {
 	return p.Label, nil
 }
 
-func processHPID(p *process.Process, ctx *psContext) (string, error) {
+func processHPID(p *process.Process, ctx *psContext) (interface{}, error) {
 	if hp := findHostProcess(p, ctx); hp != nil {
-		return hp.Pid, nil
+		return strconv.Atoi(hp.Pid)
 	}
 
-	return "?", nil
+	return nil, nil
 }
 
 // processHUSER returns the effective user ID of the corresponding host process
-// of the (container) or "?" if no corresponding process could be found.
-func processHUSER(p *process.Process, ctx *psContext) (string, error) {
+// of the (container) or nil if no corresponding process could be found.
+func processHUSER(p *process.Process, ctx *psContext) (interface{}, error) {
 	if hp := findHostProcess(p, ctx); hp != nil {
 		if ctx.opts != nil && len(ctx.opts.UIDMap) > 0 {
-			return findID(hp.Status.Uids[1], ctx.opts.UIDMap, process.LookupUID, "/proc/sys/fs/overflowuid")
+			return findID(ctx.fsys, hp.Status.Uids[1], ctx.opts.UIDMap, process.LookupUID, "/proc/sys/fs/overflowuid")
 		}
 
 		return hp.Huser, nil
 	}
 
-	return "?", nil
+	return nil, nil
 }
 
-func processHGROUP(p *process.Process, ctx *psContext) (string, error) {
+func processHGROUP(p *process.Process, ctx *psContext) (interface{}, error) {
 	if hp := findHostProcess(p, ctx); hp != nil {
 		if ctx.opts != nil && len(ctx.opts.GIDMap) > 0 {
-			return findID(hp.Status.Gids[1], ctx.opts.GIDMap, process.LookupGID, "/proc/sys/fs/overflowgid")
+			return findID(ctx.fsys, hp.Status.Gids[1], ctx.opts.GIDMap, process.LookupGID, "/proc/sys/fs/overflowgid")
 		}
 
 		return hp.Hgroup, nil
 	}
 
-	return "?", nil
+	return nil, nil
 }
 
-func processRSS(p *process.Process, ctx *psContext) (string, error) {
-	if p.Status.VMRSS == "" {
-		return "0", nil
-	}
-
-	return p.Status.VMRSS, nil
+// processRSS returns the resident set size of process p in bytes.
+func processRSS(p *process.Process, ctx *psContext) (interface{}, error) {
+	return statusMemory(p.Status.VMRSS)
 }
 
-func processState(p *process.Process, ctx *psContext) (string, error) {
-	return p.Status.State, nil
+func processState(p *process.Process, ctx *psContext) (interface{}, error) {
+	return p.Stat.State, nil
 }
 
-func processRGROUP(p *process.Process, ctx *psContext) (string, error) {
-	return process.LookupGID(p.Status.Gids[0])
+func processRGROUP(p *process.Process, ctx *psContext) (interface{}, error) {
+	return process.LookupGID(ctx.fsys, p.Status.Gids[0])
 }
 
 // processPPID returns the parent process ID of process p.
-func processPPID(p *process.Process, ctx *psContext) (string, error) {
-	return p.Status.PPid, nil
+func processPPID(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.Ppid)
+}
+
+// processTID returns the thread ID of p, which is the process ID unless
+// threads are listed.
+func processTID(p *process.Process, ctx *psContext) (interface{}, error) {
+	if p.Tid == "" {
+		return strconv.Atoi(p.Pid)
+	}
+
+	return strconv.Atoi(p.Tid)
+}
+
+// processNLWP returns the number of threads of process p.
+func processNLWP(p *process.Process, ctx *psContext) (interface{}, error) {
+	return strconv.Atoi(p.Stat.NumThreads)
+}
+
+// processTNAME returns the name of thread p, which is the command name of
+// the main thread unless threads are listed.
+func processTNAME(p *process.Process, ctx *psContext) (interface{}, error) {
+	return p.Stat.Comm, nil
 }
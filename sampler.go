@@ -0,0 +1,205 @@
+package ps
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scmn-dev/ps/internal/host"
+	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/process"
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// Sampler keeps the CPU times and I/O counters of processes across
+// consecutive listings to compute their CPU usage and I/O rates during the
+// interval between two listings instead of over their whole lifetime.  Pass
+// the same Sampler via ProcessInfoOpts to each listing; the "pcpu" descriptor
+// then reports the per-interval usage and the I/O rate descriptors (e.g.,
+// "read_bytes_rate") the rates of every process seen in the previous
+// listing.
+//
+// Processes are identified by their pid, thread ID, start time and pid
+// namespace, so a reused pid is not mistaken for the process previously
+// holding it.  A Sampler is safe for concurrent use, but concurrent listings
+// sharing one Sampler shorten each other's intervals.
+type Sampler struct {
+	mu      sync.Mutex
+	gen     int
+	samples map[sampleKey]*processSample
+	summary Summary
+}
+
+// Summary summarizes the processes seen in the last listing of a Sampler.
+type Summary struct {
+	// Time is the time the listing started.
+	Time time.Time
+	// Uptime is the time since the system was booted.
+	Uptime time.Duration
+	// Load is the system load averaged over the last 1, 5 and 15 minutes.
+	Load [3]float64
+	// Processes is the number of processes.
+	Processes int
+	// States counts the processes by their state (e.g., "R" or "S").
+	States map[string]int
+	// CPU is the sum of the per-interval CPU usage of all processes in
+	// percent of one CPU.
+	CPU float64
+}
+
+type sampleKey struct {
+	pidNS     string
+	pid       string
+	tid       string
+	starttime string
+}
+
+type processSample struct {
+	gen   int
+	ticks int64
+	at    time.Time
+	pcpu  float64
+	// interval is set if pcpu is a per-interval value.
+	interval bool
+	// io holds the I/O counters if they could be read.
+	io *proc.IO
+	// prevIO holds the I/O counters of the previous listing, which were
+	// read elapsed seconds before io.
+	prevIO  *proc.IO
+	elapsed float64
+}
+
+// NewSampler returns a new Sampler.
+func NewSampler() *Sampler {
+	return &Sampler{samples: make(map[sampleKey]*processSample)}
+}
+
+// Summary returns the summary of the last listing.
+func (s *Sampler) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := s.summary
+	summary.States = make(map[string]int, len(s.summary.States))
+	for state, n := range s.summary.States {
+		summary.States[state] = n
+	}
+
+	return summary
+}
+
+// begin starts a new listing of the processes in fsys and forgets all
+// processes not seen in the previous one.
+func (s *Sampler) begin(fsys procfs.FS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+	for key, sample := range s.samples {
+		if sample.gen < s.gen-1 {
+			delete(s.samples, key)
+		}
+	}
+
+	now := procfs.Now(fsys)
+	bootTime, err := host.BootTime(fsys)
+	if err != nil {
+		return err
+	}
+
+	load, err := host.LoadAverage(fsys)
+	if err != nil {
+		return err
+	}
+
+	s.summary = Summary{
+		Time:   now,
+		Uptime: now.Sub(time.Unix(bootTime, 0)),
+		Load:   load,
+		States: make(map[string]int),
+	}
+
+	return nil
+}
+
+// observe samples the CPU time and I/O counters of p, which was parsed from
+// fsys.
+func (s *Sampler) observe(p *process.Process, fsys procfs.FS) error {
+	user, err := strconv.ParseInt(p.Stat.Utime, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	system, err := strconv.ParseInt(p.Stat.Stime, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	clockTicks, err := host.ClockTicksOf(fsys)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sampleKey{pidNS: p.PidNS, pid: p.Pid, tid: p.Tid, starttime: p.Stat.Starttime}
+	prev := s.samples[key]
+	if prev != nil && prev.gen == s.gen {
+		// already observed in this listing
+		return nil
+	}
+
+	sample := &processSample{gen: s.gen, ticks: user + system, at: p.StatTime, io: p.IO}
+	if prev != nil {
+		if elapsed := sample.at.Sub(prev.at).Seconds(); elapsed > 0 {
+			cpu := float64(sample.ticks-prev.ticks) / float64(clockTicks)
+			sample.pcpu = 100 * cpu / elapsed
+			sample.interval = true
+			sample.prevIO, sample.elapsed = prev.io, elapsed
+		}
+	}
+	s.samples[key] = sample
+
+	s.summary.Processes++
+	s.summary.States[p.Stat.State]++
+	if sample.interval {
+		s.summary.CPU += sample.pcpu
+	}
+
+	return nil
+}
+
+// pcpu returns the per-interval CPU usage of p in percent.  It returns false
+// if p was not seen in the previous listing.
+func (s *Sampler) pcpu(p *process.Process) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := s.samples[sampleKey{pidNS: p.PidNS, pid: p.Pid, tid: p.Tid, starttime: p.Stat.Starttime}]
+	if sample == nil || !sample.interval {
+		return 0, false
+	}
+
+	return sample.pcpu, true
+}
+
+// ioRate returns the per-second rate of the I/O counter field of p during
+// the interval since the previous listing.  It returns false if p was not
+// seen in the previous listing or its I/O counters cannot be read.
+func (s *Sampler) ioRate(p *process.Process, field func(*proc.IO) uint64) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := s.samples[sampleKey{pidNS: p.PidNS, pid: p.Pid, tid: p.Tid, starttime: p.Stat.Starttime}]
+	if sample == nil || sample.io == nil || sample.prevIO == nil {
+		return 0, false
+	}
+
+	cur, prev := field(sample.io), field(sample.prevIO)
+	if cur < prev {
+		return 0, true
+	}
+
+	return float64(cur-prev) / sample.elapsed, true
+}
@@ -0,0 +1,225 @@
+package ps
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scmn-dev/ps/internal/proc"
+	"github.com/scmn-dev/ps/internal/process"
+	"github.com/scmn-dev/ps/internal/procfs"
+)
+
+// Socket is a socket of a process as listed by SocketsByPids.
+type Socket struct {
+	// PID is the ID of the process the socket is open in.  A socket
+	// shared by several processes is listed once for each of them.
+	PID int
+	// User is the effective user of the process.
+	User string
+	// Container is the ID of the container of the process or empty if it
+	// doesn't run in a container.
+	Container string
+	// Proto is the protocol, i.e., "tcp", "tcp6", "udp", "udp6" or "unix".
+	Proto string
+	// Local is the local address (e.g., "127.0.0.1:80" or "[::]:22") or,
+	// for unix sockets, the path the socket is bound to.
+	Local string
+	// Remote is the peer address of an inet socket.
+	Remote string
+	// State is the state of the socket as named by ss(8) (e.g., "LISTEN",
+	// "ESTAB" or "UNCONN").
+	State string
+	// Inode is the inode number of the socket.
+	Inode uint64
+}
+
+// Listening returns true if s accepts connections or, for udp, is bound to
+// a port.
+func (s Socket) Listening() bool {
+	if s.State == "LISTEN" {
+		return true
+	}
+
+	return strings.HasPrefix(s.Proto, "udp") && s.State == "UNCONN" && !strings.HasSuffix(s.Local, ":0")
+}
+
+// newSocket converts s of process p to a Socket.
+func newSocket(p *process.Process, s proc.Socket, user, container string) Socket {
+	socket := Socket{
+		User:      user,
+		Container: container,
+		Proto:     s.Proto,
+		State:     s.State,
+		Inode:     s.Inode,
+	}
+	socket.PID, _ = strconv.Atoi(p.Pid)
+
+	if s.Proto == "unix" {
+		socket.Local = s.Path
+	} else {
+		socket.Local = net.JoinHostPort(s.LocalIP.String(), strconv.Itoa(s.LocalPort))
+		socket.Remote = net.JoinHostPort(s.RemoteIP.String(), strconv.Itoa(s.RemotePort))
+	}
+
+	return socket
+}
+
+// socketTables caches the socket tables of each network namespace.
+type socketTables map[string]map[uint64]proc.Socket
+
+// lookup returns the sockets of the network namespace of p by their inode
+// number.  The table is parsed once per network namespace.
+func (t *socketTables) lookup(fsys procfs.FS, p *process.Process) (map[uint64]proc.Socket, error) {
+	if table, ok := (*t)[p.NetNS]; ok && p.NetNS != "" {
+		return table, nil
+	}
+
+	sockets, err := proc.ParseSockets(fsys, p.Pid)
+	if err != nil {
+		// the process exited meanwhile
+		if os.IsNotExist(err) {
+			return map[uint64]proc.Socket{}, nil
+		}
+
+		return nil, err
+	}
+
+	table := make(map[uint64]proc.Socket, len(sockets))
+	for _, s := range sockets {
+		table[s.Inode] = s
+	}
+
+	if p.NetNS != "" {
+		if *t == nil {
+			*t = make(socketTables)
+		}
+		(*t)[p.NetNS] = table
+	}
+
+	return table, nil
+}
+
+// SocketsByPids returns the sockets of the processes with the specified pids
+// or of all processes if pids is empty.  The sockets are looked up in the
+// network namespace of each process, so the sockets of a container are
+// listed without joining it.  Processes the caller may not trace are skipped.
+func SocketsByPids(pids []string, options *ProcessInfoOpts) ([]Socket, error) {
+	return SocketsByPidsContext(context.Background(), pids, options)
+}
+
+// SocketsByPidsContext is like SocketsByPids but returns the sockets listed
+// so far along with a *TimeoutError once ctx is done.
+func SocketsByPidsContext(ctx context.Context, pids []string, options *ProcessInfoOpts) ([]Socket, error) {
+	fsys := options.fs()
+
+	if len(pids) == 0 {
+		var err error
+		pids, err = proc.GetPIDs(fsys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	processes, err := process.FromPIDs(ctx, pids, process.Options{Sources: process.SourceStatus | process.SourceSockets | process.SourceCgroup, FS: fsys})
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+
+	var tables socketTables
+	sockets := []Socket{}
+	for _, p := range processes {
+		if err := ctx.Err(); err != nil {
+			return sockets, &TimeoutError{Err: err}
+		}
+
+		if len(p.SocketInodes) == 0 {
+			continue
+		}
+
+		table, err := tables.lookup(fsys, p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing sockets of PID %s", p.Pid)
+		}
+
+		user, err := process.LookupUID(fsys, p.Status.Uids[1])
+		if err != nil {
+			return nil, err
+		}
+
+		container := proc.DetectContainer(p.Cgroups).ID
+		for _, inode := range p.SocketInodes {
+			if s, ok := table[inode]; ok {
+				sockets = append(sockets, newSocket(p, s, user, container))
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return sockets, &TimeoutError{Err: err}
+	}
+
+	return sockets, nil
+}
+
+// processNSOCKETS returns the number of open sockets of process p.
+func processNSOCKETS(p *process.Process, ctx *psContext) (interface{}, error) {
+	if p.SocketInodes == nil {
+		return nil, nil
+	}
+
+	return len(p.SocketInodes), nil
+}
+
+// processPORTS returns the ports process p listens on (e.g.,
+// "22/tcp,53/udp") in ascending order.
+func processPORTS(p *process.Process, ctx *psContext) (interface{}, error) {
+	if p.SocketInodes == nil {
+		return nil, nil
+	}
+
+	table, err := ctx.sockets.lookup(ctx.fsys, p)
+	if err != nil {
+		return nil, err
+	}
+
+	type port struct {
+		num   int
+		proto string
+	}
+
+	seen := make(map[port]bool)
+	ports := []port{}
+	for _, inode := range p.SocketInodes {
+		s, ok := table[inode]
+		if !ok || s.Proto == "unix" || !newSocket(p, s, "", "").Listening() {
+			continue
+		}
+
+		// list IPv4 and IPv6 sockets alike
+		pt := port{s.LocalPort, strings.TrimSuffix(s.Proto, "6")}
+		if !seen[pt] {
+			seen[pt] = true
+			ports = append(ports, pt)
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].num != ports[j].num {
+			return ports[i].num < ports[j].num
+		}
+		return ports[i].proto < ports[j].proto
+	})
+
+	list := []string{}
+	for _, pt := range ports {
+		list = append(list, fmt.Sprintf("%d/%s", pt.num, pt.proto))
+	}
+
+	return strings.Join(list, ","), nil
+}
@@ -0,0 +1,156 @@
+package ps
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SortKey specifies a descriptor to sort processes by.
+type SortKey struct {
+	// Descriptor is the AIX code or the name of the descriptor.
+	Descriptor string
+	// Descending reverses the order of the key.
+	Descending bool
+}
+
+// sortKey is a SortKey with the translated descriptor.
+type sortKey struct {
+	desc       aixFormatDescriptor
+	descending bool
+}
+
+// ErrInvalidSortKey is returned when a sort specification cannot be parsed.
+var ErrInvalidSortKey = errors.New("invalid sort key")
+
+// ParseSortKeys parses a comma-separated list of descriptors to sort by, such
+// as "-rss,pid".  A descriptor prefixed with "-" is sorted in descending, one
+// without or with a "+" prefix in ascending order.  Processes comparing equal
+// for the first key are sorted by the second one and so forth.
+func ParseSortKeys(spec string) ([]SortKey, error) {
+	keys := []SortKey{}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		key := SortKey{}
+		switch {
+			case strings.HasPrefix(field, "-"):
+				key.Descending = true
+				field = field[1:]
+			case strings.HasPrefix(field, "+"):
+				field = field[1:]
+		}
+
+		if field == "" {
+			return nil, errors.Wrapf(ErrInvalidSortKey, "'%s'", spec)
+		}
+
+		key.Descriptor = field
+		keys = append(keys, key)
+	}
+
+	if _, err := translateSortKeys(keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func translateSortKeys(keys []SortKey) ([]sortKey, error) {
+	translated := []sortKey{}
+	for _, k := range keys {
+		descs, err := translateDescriptors([]string{k.Descriptor})
+		if err != nil {
+			return nil, err
+		}
+
+		translated = append(translated, sortKey{desc: descs[0], descending: k.Descending})
+	}
+
+	return translated, nil
+}
+
+// sortRows sorts rows in place by the specified keys.  The sort is stable, so
+// rows comparing equal for all keys keep their order.
+func sortRows(rows []Row, keys []sortKey) {
+	if len(keys) == 0 {
+		return
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			c := compareValues(rows[i][k.desc.normal], rows[j][k.desc.normal])
+			if c == 0 {
+				continue
+			}
+
+			if k.descending {
+				return c > 0
+			}
+
+			return c < 0
+		}
+
+		return false
+	})
+}
+
+// compareValues compares two typed row values and returns -1, 0 or +1 if a is
+// less than, equal to or greater than b.  Numbers, durations and times are
+// compared by value, all other types by their string representation.  Nil
+// values (i.e., unavailable data) are less than any other value.
+func compareValues(a, b interface{}) int {
+	switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		case b == nil:
+			return 1
+	}
+
+	if x, ok := numericValue(a); ok {
+		if y, ok := numericValue(b); ok {
+			switch {
+				case x < y:
+					return -1
+				case x > y:
+					return 1
+			}
+			return 0
+		}
+	}
+
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			switch {
+				case x.Before(y):
+					return -1
+				case x.After(y):
+					return 1
+			}
+			return 0
+		}
+	}
+
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+// numericValue returns value as a float64 if it is of a numeric type.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+		case int:
+			return float64(v), true
+		case int64:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		case float64:
+			return v, true
+		case time.Duration:
+			return float64(v), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,129 @@
+package ps
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TreeStyle is the style of the branches drawn in a process tree.
+type TreeStyle int
+
+const (
+	// TreeNone disables the tree view.
+	TreeNone TreeStyle = iota
+	// TreeASCII draws branches like `ps -ef --forest`.
+	TreeASCII
+	// TreeUnicode draws branches with box-drawing characters like pstree(1).
+	TreeUnicode
+)
+
+// ErrUnknownTreeStyle is returned when an unknown tree style is parsed.
+var ErrUnknownTreeStyle = errors.New("unknown tree style")
+
+// ParseTreeStyle parses "ascii" or "unicode" into a TreeStyle.
+func ParseTreeStyle(style string) (TreeStyle, error) {
+	switch strings.ToLower(style) {
+		case "ascii":
+			return TreeASCII, nil
+		case "unicode":
+			return TreeUnicode, nil
+	}
+
+	return TreeNone, errors.Wrapf(ErrUnknownTreeStyle, "'%s'", style)
+}
+
+// treeIndentDescriptors are the descriptors whose values are indented in a
+// tree.
+var treeIndentDescriptors = []string{"args", "comm"}
+
+// treeNode is a process in a tree.  It has more than one row if threads
+// are listed.
+type treeNode struct {
+	rows     []Row
+	children []*treeNode
+}
+
+// arrangeTree returns rows in depth-first order, with every process following
+// its parent, and prefixes the values of treeIndentDescriptors with branches.
+// Processes whose parent is not part of rows (e.g., PID 1 or the first
+// process of a container whose parents live on the host) become roots.  The
+// order of siblings is preserved.  rows must contain "pid" and "ppid".
+func arrangeTree(rows []Row, style TreeStyle) []Row {
+	nodes := make(map[interface{}]*treeNode, len(rows))
+	ordered := []*treeNode{}
+	for _, row := range rows {
+		node, exists := nodes[row["pid"]]
+		if !exists {
+			node = &treeNode{}
+			nodes[row["pid"]] = node
+			ordered = append(ordered, node)
+		}
+		node.rows = append(node.rows, row)
+	}
+
+	roots := []*treeNode{}
+	for _, node := range ordered {
+		parent, exists := nodes[node.rows[0]["ppid"]]
+		if !exists || parent == node {
+			roots = append(roots, node)
+			continue
+		}
+		parent.children = append(parent.children, node)
+	}
+
+	arranged := []Row{}
+	visited := make(map[*treeNode]bool, len(rows))
+	var walk func(node *treeNode, indent string, depth int, last bool)
+	walk = func(node *treeNode, indent string, depth int, last bool) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+
+		prefix, childIndent := treeBranch(style, indent, depth, last)
+		for _, row := range node.rows {
+			for _, name := range treeIndentDescriptors {
+				if value, ok := row[name].(string); ok {
+					row[name] = prefix + value
+				}
+			}
+			arranged = append(arranged, row)
+		}
+
+		for i, child := range node.children {
+			walk(child, childIndent, depth+1, i == len(node.children)-1)
+		}
+	}
+
+	for _, root := range roots {
+		walk(root, "", 0, true)
+	}
+
+	// processes in a parent cycle (e.g., due to pid reuse while reading
+	// /proc) are not reachable from any root
+	for _, node := range ordered {
+		if !visited[node] {
+			walk(node, "", 0, true)
+		}
+	}
+
+	return arranged
+}
+
+// treeBranch returns the prefix of a process at the specified depth and the
+// indentation to pass on to its children.
+func treeBranch(style TreeStyle, indent string, depth int, last bool) (string, string) {
+	if depth == 0 {
+		return "", ""
+	}
+
+	if style == TreeUnicode {
+		if last {
+			return indent + "└─ ", indent + "   "
+		}
+		return indent + "├─ ", indent + "│  "
+	}
+
+	return indent + " \\_ ", indent + "    "
+}